@@ -1,14 +1,35 @@
 package app
 
 import (
+	"errors"
 	"os"
+	"strconv"
 
 	"github.com/redis/go-redis/v9"
+	core "neon-clicker/core"
+)
+
+// Environments accepted in APP_ENV
+const (
+	EnvProduction  = "production"
+	EnvDevelopment = "development"
 )
 
 type Config struct {
 	RedisAddr string
 	BotToken  string
+	// Env is APP_ENV; anything but "development" is treated as production
+	Env string
+	// DevAuth enables the unverified "dev" auth provider (DEV_AUTH=true)
+	DevAuth bool
+	// TrustProxy takes client IPs for rate limiting from proxy headers (TRUST_PROXY=true)
+	TrustProxy bool
+	// MetricsAddr is where expvar metrics (/debug/vars) are served (METRICS_ADDR);
+	// keep it off the public network
+	MetricsAddr string
+	// RateLimits overrides per-route request budgets (RATE_LIMITS, see core.ParseRateLimits)
+	RateLimits    map[string]core.RateLimit
+	rateLimitsErr error
 }
 
 func LoadConfig() Config {
@@ -16,10 +37,46 @@ func LoadConfig() Config {
 	if addr == "" {
 		addr = "localhost:6379"
 	}
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = EnvProduction
+	}
+	devAuth, _ := strconv.ParseBool(os.Getenv("DEV_AUTH"))
+	trustProxy, _ := strconv.ParseBool(os.Getenv("TRUST_PROXY"))
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = "127.0.0.1:9090"
+	}
+	rateLimits, rateLimitsErr := core.ParseRateLimits(os.Getenv("RATE_LIMITS"))
 	return Config{
-		RedisAddr: addr,
-		BotToken:  os.Getenv("TELEGRAM_BOT_TOKEN"),
+		RedisAddr:     addr,
+		BotToken:      os.Getenv("TELEGRAM_BOT_TOKEN"),
+		Env:           env,
+		DevAuth:       devAuth,
+		TrustProxy:    trustProxy,
+		MetricsAddr:   metricsAddr,
+		RateLimits:    rateLimits,
+		rateLimitsErr: rateLimitsErr,
+	}
+}
+
+// Production reports whether the server runs in production mode
+func (c Config) Production() bool {
+	return c.Env != EnvDevelopment
+}
+
+// Validate rejects configurations the server must not start with
+func (c Config) Validate() error {
+	if c.DevAuth && c.Production() {
+		return errors.New("DEV_AUTH cannot be enabled in production; set APP_ENV=development")
+	}
+	if c.BotToken == "" && !c.DevAuth {
+		return errors.New("TELEGRAM_BOT_TOKEN is required unless DEV_AUTH is enabled")
+	}
+	if c.rateLimitsErr != nil {
+		return errors.New("RATE_LIMITS: " + c.rateLimitsErr.Error())
 	}
+	return nil
 }
 
 func NewRedis(addr string) *redis.Client {
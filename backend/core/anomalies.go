@@ -0,0 +1,72 @@
+package core
+
+// ScoreSample is a snapshot of the counters a user's score growth is checked against
+type ScoreSample struct {
+	At             int64 `json:"at"`
+	Score          int64 `json:"score"`
+	Clicks         int64 `json:"clicks"`
+	Credits        int64 `json:"credits"`
+	ProductionRate int64 `json:"production_rate"`
+}
+
+// ScoreAnomaly is the evidence recorded when a user's score grew more than
+// their play can explain
+type ScoreAnomaly struct {
+	UserID         string `json:"user_id"`
+	Reason         string `json:"reason"`
+	DetectedAt     int64  `json:"detected_at"`
+	WindowSeconds  int64  `json:"window_seconds"`
+	ScoreDelta     int64  `json:"score_delta"`
+	ExplainedDelta int64  `json:"explained_delta"`
+	ClicksDelta    int64  `json:"clicks_delta"`
+	CreditsDelta   int64  `json:"credits_delta"`
+	Power          int64  `json:"power"`
+	ProductionRate int64  `json:"production_rate"`
+}
+
+// Reasons a score anomaly is recorded
+const (
+	ScoreAnomalyUnexplainedGrowth = "unexplained_growth"
+	ScoreAnomalyClickRate         = "click_rate"
+)
+
+// ExplainedScoreGrowth is the most a user's score can have grown between two
+// samples: clicks at the current power (power never drops), production at the
+// higher of the two rates, and score credited by other players or rewards.
+func ExplainedScoreGrowth(prev, cur ScoreSample, power int64) int64 {
+	rate := prev.ProductionRate
+	if cur.ProductionRate > rate {
+		rate = cur.ProductionRate
+	}
+	return (cur.Clicks-prev.Clicks)*power + rate*(cur.At-prev.At) + (cur.Credits - prev.Credits)
+}
+
+// DetectScoreAnomaly compares two samples of the same user and returns the
+// evidence when the growth between them is implausible, or nil
+func DetectScoreAnomaly(userID string, prev, cur ScoreSample, power int64) *ScoreAnomaly {
+	window := cur.At - prev.At
+	if window <= 0 {
+		return nil
+	}
+	a := ScoreAnomaly{
+		UserID:         userID,
+		DetectedAt:     cur.At,
+		WindowSeconds:  window,
+		ScoreDelta:     cur.Score - prev.Score,
+		ExplainedDelta: ExplainedScoreGrowth(prev, cur, power),
+		ClicksDelta:    cur.Clicks - prev.Clicks,
+		CreditsDelta:   cur.Credits - prev.Credits,
+		Power:          power,
+		ProductionRate: cur.ProductionRate,
+	}
+	switch {
+	case a.ClicksDelta > ClickBatchMaxTapsPerSecond*window:
+		a.Reason = ScoreAnomalyClickRate
+	case a.ScoreDelta-a.ExplainedDelta > ScoreAnomalyMinUnexplained &&
+		a.ScoreDelta*100 > a.ExplainedDelta*(100+ScoreAnomalyTolerancePercent):
+		a.Reason = ScoreAnomalyUnexplainedGrowth
+	default:
+		return nil
+	}
+	return &a
+}
@@ -0,0 +1,60 @@
+package core
+
+import "time"
+
+// CommunityBuffTier is a community-wide production buff activated when a
+// donation goal's total reaches Percent of its target
+type CommunityBuffTier struct {
+	Percent           int           `json:"percent"`
+	ProductionPercent int           `json:"production_percent"`
+	Duration          time.Duration `json:"-"`
+}
+
+// CommunityBuffTiers lists goal progress milestones in ascending order
+var CommunityBuffTiers = []CommunityBuffTier{
+	{Percent: 25, ProductionPercent: 5, Duration: 24 * time.Hour},
+	{Percent: 50, ProductionPercent: 10, Duration: 24 * time.Hour},
+	{Percent: 75, ProductionPercent: 15, Duration: 24 * time.Hour},
+	{Percent: 100, ProductionPercent: 25, Duration: 48 * time.Hour},
+}
+
+// CommunityBuff is an active global buff earned by a donation goal milestone
+type CommunityBuff struct {
+	GoalID            int    `json:"goal_id"`
+	GoalName          string `json:"goal_name"`
+	Milestone         int    `json:"milestone"`
+	ProductionPercent int    `json:"production_percent"`
+	StartedAt         int64  `json:"started_at"`
+	ExpiresAt         int64  `json:"expires_at"`
+}
+
+// CommunityBuffThreshold is the donation total at which a tier activates
+func CommunityBuffThreshold(target int64, tier CommunityBuffTier) int64 {
+	p := int64(tier.Percent)
+	return target/100*p + target%100*p/100
+}
+
+// CommunityBuffTiersCrossed returns the tiers a donation moving the goal total
+// from before to after has reached
+func CommunityBuffTiersCrossed(before int64, after int64, target int64) []CommunityBuffTier {
+	var crossed []CommunityBuffTier
+	for _, tier := range CommunityBuffTiers {
+		threshold := CommunityBuffThreshold(target, tier)
+		if before < threshold && after >= threshold {
+			crossed = append(crossed, tier)
+		}
+	}
+	return crossed
+}
+
+// CommunityBuffPercent is the combined production bonus of the active buffs
+func CommunityBuffPercent(buffs []CommunityBuff) int {
+	total := 0
+	for _, b := range buffs {
+		total += b.ProductionPercent
+	}
+	if total > CommunityBuffMaxPercent {
+		total = CommunityBuffMaxPercent
+	}
+	return total
+}
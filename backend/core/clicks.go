@@ -0,0 +1,94 @@
+package core
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// ClickFlag records why a player was excluded from leaderboards for review
+type ClickFlag struct {
+	UserID    string `json:"user_id"`
+	Strikes   int64  `json:"strikes"`
+	Reason    string `json:"reason"`
+	FlaggedAt int64  `json:"flagged_at"`
+}
+
+// Reasons a click strike is issued
+const (
+	ClickStrikeRateLimit  = "rate_limit"
+	ClickStrikeRegularity = "regular_intervals"
+)
+
+// ClickIntervalsSuspicious reports whether a sample of click timestamps (ms,
+// any order) is spaced too evenly to come from a human finger. Slow clicking
+// is never flagged.
+func ClickIntervalsSuspicious(times []int64) bool {
+	if len(times) < ClickSampleSize {
+		return false
+	}
+	sorted := append([]int64(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n := float64(len(sorted) - 1)
+	mean := float64(sorted[len(sorted)-1]-sorted[0]) / n
+	if mean <= 0 || mean > ClickRegularityMaxMeanMs {
+		return false
+	}
+	variance := 0.0
+	for i := 1; i < len(sorted); i++ {
+		d := float64(sorted[i]-sorted[i-1]) - mean
+		variance += d * d
+	}
+	return math.Sqrt(variance/n)/mean < ClickRegularityMaxCV
+}
+
+// ClickBatch is a client's report of the taps made during [StartedAt, EndedAt]
+// (unix ms). Seq increases with every batch the client sends. Offsets holds
+// each tap's time in ms after StartedAt, in order.
+type ClickBatch struct {
+	Seq       int64   `json:"seq"`
+	Taps      int64   `json:"taps"`
+	StartedAt int64   `json:"started_at"`
+	EndedAt   int64   `json:"ended_at"`
+	Offsets   []int64 `json:"offsets"`
+}
+
+// ValidateClickBatch checks a batch's shape and timing, returning a message
+// describing the first problem. Whether the tap count is plausible depends on
+// the previous batch and is checked when the batch is applied (see
+// ClickBatchMaxTaps and ClickBatchMaxTapsPerSecond).
+func ValidateClickBatch(b ClickBatch, now time.Time) string {
+	if b.Seq <= 0 || b.Taps <= 0 || b.Taps > ClickBatchMaxTaps {
+		return "invalid batch"
+	}
+	nowMs := now.UnixMilli()
+	if b.EndedAt < b.StartedAt || b.EndedAt > nowMs+ClickBatchClockSkew.Milliseconds() {
+		return "invalid time window"
+	}
+	if b.StartedAt < nowMs-ClickBatchMaxAge.Milliseconds() {
+		return "batch too old"
+	}
+	if int64(len(b.Offsets)) != b.Taps {
+		return "invalid tap timings"
+	}
+	prev := int64(0)
+	for _, o := range b.Offsets {
+		if o < prev || o > b.EndedAt-b.StartedAt {
+			return "invalid tap timings"
+		}
+		prev = o
+	}
+	return ""
+}
+
+// TapTimes returns the absolute time (unix ms) of the first n taps in the batch
+func (b ClickBatch) TapTimes(n int64) []int64 {
+	if n > int64(len(b.Offsets)) {
+		n = int64(len(b.Offsets))
+	}
+	times := make([]int64, n)
+	for i := range times {
+		times[i] = b.StartedAt + b.Offsets[i]
+	}
+	return times
+}
@@ -10,9 +10,66 @@ const (
     SessionTTL   = 90 * 24 * time.Hour
     UserDataTTL  = 365 * 24 * time.Hour
 
+    // Sessions
+    TelegramInitDataMaxAge = 24 * time.Hour
+    SessionTokenBytes   = 32
+    SessionRotateAfter  = 24 * time.Hour
+    SessionMaxPerUser   = 10
+    SessionDeviceMaxLen = 64
+
     // Leaderboards
-    LeaderboardPageSize       = 20
-    PerSecondLeaderboardLimit = 20
+    LeaderboardPageSize        = 20
+    LeaderboardMaxPageSize     = 100
+    LeaderboardAroundWindow    = 5
+    LeaderboardMaxAroundWindow = 25
+    PerSecondLeaderboardLimit  = 20
+    LeaderboardDayRetention    = 48 * time.Hour
+    LeaderboardWeekRetention   = 14 * 24 * time.Hour
+    LeaderboardScopeViewTTL    = 30 * time.Second
+
+    // Rank history
+    RankHistoryHourlyRetention = 7 * 24 * time.Hour
+    RankHistoryDailyRetention  = 90 * 24 * time.Hour
+    RankSnapshotCheckInterval  = time.Minute
+    RankSnapshotBatchSize      = 500
+
+    // Click limiting and autoclicker detection
+    ClickBucketCapacity       = 30
+    ClickRefillPerSecond      = 15
+    ClickThrottledPercent     = 50
+    ClickRejectsPerStrike     = 100
+    ClickSampleSize           = 50
+    ClickRegularityCheckEvery = 25
+    ClickRegularityMaxMeanMs  = 1000
+    ClickRegularityMaxCV      = 0.05
+    ClickStrikesThrottle      = 2
+    ClickStrikesFlag          = 3
+    ClickStrikeDecay          = 7 * 24 * time.Hour
+    ClickThrottleDuration     = time.Hour
+    LeaderboardExclusionTTL   = 3 * time.Second
+
+    // Score anomaly detection
+    ScoreAnomalyScanInterval     = 5 * time.Minute
+    ScoreAnomalyMaxWindow        = time.Hour
+    ScoreAnomalyTolerancePercent = 10
+    ScoreAnomalyMinUnexplained   = 1000
+    ScoreAnomalyLogSize          = 20
+    ScoreAnomalyBatchSize        = 500
+
+    // Request rate limiting (per-route budgets live in RouteRateLimits and RATE_LIMITS)
+    RateLimitIPMultiplier = 5
+
+    // Idempotency-Key replay for state-changing requests
+    IdempotencyTTL          = 24 * time.Hour
+    IdempotencyLockTTL      = 30 * time.Second
+    IdempotencyKeyMaxLength = 128
+
+    // Batched click submission
+    ClickBatchMaxTaps          = 600
+    ClickBatchMaxTapsPerSecond = 20
+    ClickBatchMaxAge           = time.Minute
+    ClickBatchClockSkew        = 5 * time.Second
+    ClickBatchStateTTL         = 24 * time.Hour
 
     // Power upgrade pricing model
     PaybackClicks = 200
@@ -23,4 +80,73 @@ const (
     BuildTimeMinPrice         = 1000000
     BuildTimeMaxPrice         = 500_000_000
     BuildTimeMaxSeconds       = 172800 // 48h
+
+    // Guilds
+    GuildCreateCost                 = 100000
+    GuildMaxMembers                 = 30
+    GuildNameMinLength              = 3
+    GuildNameMaxLength              = 24
+    GuildLeaderboardRefreshInterval = 30 * time.Second
+
+    // Referrals
+    ReferralMaxChainDepth = 64
+
+    // Friends
+    FriendsMax = 200
+
+    // Display names
+    DisplayNameMinLength      = 3
+    DisplayNameMaxLength      = 20
+    DisplayNameRenameCooldown = 24 * time.Hour
+
+    // Gifting
+    GiftMinAmount       = 100
+    GiftFeePercent      = 5
+    GiftDailySendCap    = 1_000_000
+    GiftDailyReceiveCap = 1_000_000
+    GiftMinAccountAge   = 72 * time.Hour
+    GiftHistoryPageSize = 20
+
+    // Producer marketplace
+    MarketFeePercent          = 5
+    MarketListingTTL          = 72 * time.Hour
+    MarketMaxListingsPerUser  = 10
+    MarketMaxPrice            = 1_000_000_000_000
+    // Listing totals must stay exact as Lua numbers (2^53 - 1)
+    MarketMaxTotal            = 9_007_199_254_740_991
+    MarketPageSize            = 20
+    MarketExpirySweepInterval = time.Minute
+
+    // Click duels
+    DuelDuration           = 30 * time.Second
+    DuelCountdown          = 3 * time.Second
+    DuelChallengeTTL       = 5 * time.Minute
+    DuelMaxPending         = 5
+    DuelMaxClicksPerSecond = 20
+    DuelInitialRating      = 1000
+    DuelEloK               = 32
+    DuelHistorySize        = 50
+    DuelSweepInterval      = time.Second
+
+    // Donation goals
+    DonationGoalRewardPercent  = 10
+    DonationGoalArchiveAfter   = 7 * 24 * time.Hour
+    DonationHistorySize        = 100
+    DonorsPageSize             = 20
+    DonorsMaxPageSize          = 100
+    DonationGoalNameMaxLength  = 48
+    DonationGoalDescMaxLength  = 500
+    DonationGoalImageMaxLength = 512
+    DonationGoalSweepInterval  = 10 * time.Second
+
+    // Community buffs
+    CommunityBuffMaxPercent = 50
+
+    // Tournaments
+    TournamentStandingsSize = 10
+    TournamentResultsSize   = 50
+    TournamentSweepInterval = 10 * time.Second
+    TournamentDataRetention = 30 * 24 * time.Hour
+    // Catching up after downtime finalizes at most this many instances per sweep
+    TournamentFinalizeBatch = 10
 )
@@ -1,15 +1,41 @@
 package core
 
+import "math/big"
+
+// Donation goal lifecycle states
+const (
+    DonationGoalLocked    = "locked"
+    DonationGoalScheduled = "scheduled"
+    DonationGoalActive    = "active"
+    DonationGoalCompleted = "completed"
+    DonationGoalClosed    = "closed"
+    DonationGoalArchived  = "archived"
+)
+
 // DonationGoal defines a global donation target for the community
 // Used by handlers like ListDonationGoals and GetDonationGoal
 type DonationGoal struct {
-    ID     int    `json:"id"`
-    Name   string `json:"name"`
-    Target int64  `json:"target"`
+    ID          int    `json:"id"`
+    Name        string `json:"name"`
+    Target      int64  `json:"target"`
+    Description string `json:"description,omitempty"`
+    ImageURL    string `json:"image_url,omitempty"`
+    StartsAt    int64  `json:"starts_at,omitempty"`
+    EndsAt      int64  `json:"ends_at,omitempty"`
+    CreatedAt   int64  `json:"created_at,omitempty"`
 }
 
-// DonationGoals is the list of global donation targets
-var DonationGoals = []DonationGoal{
+// Donation is an entry in a player's donation history
+type Donation struct {
+    GoalID    int    `json:"goal_id"`
+    GoalName  string `json:"goal_name"`
+    Amount    int64  `json:"amount"`
+    CreatedAt int64  `json:"created_at"`
+}
+
+// DefaultDonationGoals seeds the campaign store on first start; they are
+// unlocked in order. Further campaigns are managed through the admin API.
+var DefaultDonationGoals = []DonationGoal{
     {ID: 1, Name: "Pay US Debt", Target: 32000000000000},
     {ID: 2, Name: "Cleanup Oceans", Target: 92000000000000},
     {ID: 3, Name: "End Global Hunger", Target: 350000000000000},
@@ -17,3 +43,23 @@ var DonationGoals = []DonationGoal{
     {ID: 5, Name: "Build Dyson Sphere", Target: 5000000000000000},
     {ID: 6, Name: "Interstellar Highway", Target: 12000000000000000},
 }
+
+// DonationGoalRewardPool is the score shared among contributors when a goal completes
+func DonationGoalRewardPool(target int64) int64 {
+    return target / 100 * DonationGoalRewardPercent
+}
+
+// DonationReward is a contributor's share of the reward pool, proportional to their donation
+func DonationReward(pool int64, donated int64, total int64) int64 {
+    if total <= 0 || donated <= 0 {
+        return 0
+    }
+    // pool*donated can exceed int64, and float64 loses precision on large pools
+    share := new(big.Int).Mul(big.NewInt(pool), big.NewInt(donated))
+    return share.Quo(share, big.NewInt(total)).Int64()
+}
+
+// DonationGoalEnded reports whether a time-limited campaign is past its end time
+func DonationGoalEnded(goal DonationGoal, now int64) bool {
+    return goal.EndsAt > 0 && now >= goal.EndsAt
+}
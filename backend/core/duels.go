@@ -0,0 +1,29 @@
+package core
+
+// Duel lifecycle states
+const (
+	DuelStatusPending   = "pending"
+	DuelStatusActive    = "active"
+	DuelStatusFinished  = "finished"
+	DuelStatusDeclined  = "declined"
+	DuelStatusCancelled = "cancelled"
+	DuelStatusExpired   = "expired"
+)
+
+// Duel is a timed head-to-head click race with a stake from each player
+type Duel struct {
+	ID               int64  `json:"id"`
+	ChallengerID     string `json:"challenger_id"`
+	OpponentID       string `json:"opponent_id"`
+	Stake            int64  `json:"stake"`
+	Status           string `json:"status"`
+	CreatedAt        int64  `json:"created_at"`
+	ExpiresAtMs      int64  `json:"expires_at_ms"`
+	StartsAtMs       int64  `json:"starts_at_ms"`
+	EndsAtMs         int64  `json:"ends_at_ms"`
+	ChallengerClicks int64  `json:"challenger_clicks"`
+	OpponentClicks   int64  `json:"opponent_clicks"`
+	WinnerID         string `json:"winner_id"`
+	RatingDelta      int    `json:"rating_delta"`
+	IsChallenger     bool   `json:"is_challenger"`
+}
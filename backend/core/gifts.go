@@ -0,0 +1,17 @@
+package core
+
+// GiftTransfer is an entry in the player-to-player transfer log
+type GiftTransfer struct {
+	ID        int64  `json:"id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Amount    int64  `json:"amount"`
+	Fee       int64  `json:"fee"`
+	Net       int64  `json:"net"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// CalculateGiftFee returns the fee withheld from a gift of the given amount
+func CalculateGiftFee(amount int64) int64 {
+	return amount * GiftFeePercent / 100
+}
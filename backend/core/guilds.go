@@ -0,0 +1,67 @@
+package core
+
+// Guild roles, from least to most privileged
+const (
+	GuildRoleMember  = "member"
+	GuildRoleOfficer = "officer"
+	GuildRoleLeader  = "leader"
+)
+
+// Guild is a team of players sharing a treasury and production bonus
+type Guild struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	LeaderID     string `json:"leader_id"`
+	Treasury     int64  `json:"treasury"`
+	Members      int    `json:"members"`
+	BonusPercent int    `json:"bonus_percent"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// GuildMember is a guild roster entry
+type GuildMember struct {
+	UserID      string `json:"user_id"`
+	Role        string `json:"role"`
+	Score       int64  `json:"score"`
+	Contributed int64  `json:"contributed"`
+	IsSelf      bool   `json:"is_self"`
+}
+
+// GuildBonusTier grants a production bonus once the treasury reaches a threshold
+type GuildBonusTier struct {
+	Treasury int64
+	Percent  int
+}
+
+// GuildBonusTiers lists treasury thresholds in ascending order
+var GuildBonusTiers = []GuildBonusTier{
+	{Treasury: 1_000_000, Percent: 2},
+	{Treasury: 10_000_000, Percent: 5},
+	{Treasury: 100_000_000, Percent: 10},
+	{Treasury: 1_000_000_000, Percent: 15},
+	{Treasury: 10_000_000_000, Percent: 25},
+}
+
+// GuildRoleRank orders roles by privilege; unknown roles rank lowest
+func GuildRoleRank(role string) int {
+	switch role {
+	case GuildRoleLeader:
+		return 3
+	case GuildRoleOfficer:
+		return 2
+	case GuildRoleMember:
+		return 1
+	}
+	return 0
+}
+
+// GuildProductionBonusPercent returns the production bonus unlocked by a treasury
+func GuildProductionBonusPercent(treasury int64) int {
+	percent := 0
+	for _, tier := range GuildBonusTiers {
+		if treasury >= tier.Treasury {
+			percent = tier.Percent
+		}
+	}
+	return percent
+}
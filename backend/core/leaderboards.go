@@ -0,0 +1,64 @@
+package core
+
+import "time"
+
+// Leaderboard time windows, selected with the period query parameter
+const (
+	LeaderboardPeriodAll  = "all"
+	LeaderboardPeriodDay  = "day"
+	LeaderboardPeriodWeek = "week"
+)
+
+// Leaderboard scopes, selected with the scope query parameter
+const (
+	LeaderboardScopeGlobal   = "global"
+	LeaderboardScopeLanguage = "language"
+	LeaderboardScopeCountry  = "country"
+)
+
+// Boards maintained per time window
+const (
+	LeaderboardBoardEarned = "earned"
+	LeaderboardBoardClicks = "clicks"
+)
+
+// LeaderboardWindows lists the periods that have window-scoped zsets
+var LeaderboardWindows = []string{LeaderboardPeriodDay, LeaderboardPeriodWeek}
+
+// ValidLeaderboardPeriod reports whether period names a known window
+func ValidLeaderboardPeriod(period string) bool {
+	return period == LeaderboardPeriodAll || period == LeaderboardPeriodDay || period == LeaderboardPeriodWeek
+}
+
+// LeaderboardWindowKey names the zset of a board for the window of period containing t
+func LeaderboardWindowKey(board string, period string, t time.Time) string {
+	if period == LeaderboardPeriodWeek {
+		return "leaderboard_window:" + board + ":week:" + WeekKey(t)
+	}
+	return "leaderboard_window:" + board + ":day:" + DayKey(t)
+}
+
+// LeaderboardWindowRetention is how long a window's zset lives after it is created
+func LeaderboardWindowRetention(period string) time.Duration {
+	if period == LeaderboardPeriodWeek {
+		return LeaderboardWeekRetention
+	}
+	return LeaderboardDayRetention
+}
+
+// ScopeMembersKey names the set of players sharing a profile attribute (language or country)
+func ScopeMembersKey(scope string, value string) string {
+	return "scope_members:" + scope + ":" + value
+}
+
+// ScopedLeaderboardKey names the cached view of a leaderboard restricted to one scope
+func ScopedLeaderboardKey(boardKey string, scope string, value string) string {
+	return "leaderboard_scope:" + scope + ":" + value + ":" + boardKey
+}
+
+// Reasons a player is excluded from leaderboards and donor lists. A player
+// stays hidden until every reason is lifted.
+const (
+	LeaderboardExclusionClicks    = "clicks"
+	LeaderboardExclusionShadowBan = "shadow_ban"
+)
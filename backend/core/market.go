@@ -0,0 +1,29 @@
+package core
+
+// MarketListing is a batch of producer units escrowed for sale at a unit price
+type MarketListing struct {
+	ID         int64  `json:"id"`
+	SellerID   string `json:"seller_id"`
+	ProducerID int    `json:"producer_id"`
+	Quantity   int    `json:"quantity"`
+	UnitPrice  int64  `json:"unit_price"`
+	TotalPrice int64  `json:"total_price"`
+	CreatedAt  int64  `json:"created_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	IsSelf     bool   `json:"is_self"`
+}
+
+// CalculateMarketFee returns the fee withheld from the seller's proceeds
+func CalculateMarketFee(total int64) int64 {
+	return total * MarketFeePercent / 100
+}
+
+// FindProducer looks up a producer definition by ID
+func FindProducer(id int) *Producer {
+	for i := range DefaultProducers {
+		if DefaultProducers[i].ID == id {
+			return &DefaultProducers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Profile is a player's public identity
+type Profile struct {
+	DisplayName  string `json:"display_name,omitempty"`
+	Public       bool   `json:"public"`
+	Language     string `json:"language,omitempty"`
+	Country      string `json:"country,omitempty"`
+	DefaultName  string `json:"default_name,omitempty"`
+	NextRenameAt int64  `json:"next_rename_at,omitempty"`
+}
+
+// DefaultDisplayNameBlocklist is always rejected in display names, in addition
+// to words configured through DISPLAY_NAME_BLOCKLIST
+var DefaultDisplayNameBlocklist = []string{"admin", "moderator", "support", "official", "telegram"}
+
+// NormalizeDisplayName collapses whitespace and checks length and allowed
+// characters (letters, digits, spaces, '_', '-' and '.')
+func NormalizeDisplayName(name string) (string, bool) {
+	name = strings.Join(strings.Fields(name), " ")
+	if n := utf8.RuneCountInString(name); n < DisplayNameMinLength || n > DisplayNameMaxLength {
+		return name, false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '_' && r != '-' && r != '.' {
+			return name, false
+		}
+	}
+	return name, true
+}
+
+// DisplayNameKey is the case-insensitive form used to enforce uniqueness
+func DisplayNameKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// DisplayNameBlocked reports whether any word of the name is a blocked word.
+// Words are split on anything but letters and where a lowercase letter is
+// followed by an uppercase one, so "Real_Admin" and "AdminBot" are caught
+// while "Badminton" is not.
+func DisplayNameBlocked(name string, blocklist []string) bool {
+	blocked := make(map[string]bool, len(blocklist))
+	for _, word := range blocklist {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			blocked[word] = true
+		}
+	}
+	for _, word := range displayNameWords(name) {
+		if blocked[DisplayNameKey(word)] {
+			return true
+		}
+	}
+	return false
+}
+
+// displayNameWords splits a display name into its words
+func displayNameWords(name string) []string {
+	var words []string
+	var word []rune
+	prevLower := false
+	for _, r := range name {
+		if !unicode.IsLetter(r) || (prevLower && unicode.IsUpper(r)) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = word[:0]
+		}
+		if unicode.IsLetter(r) {
+			word = append(word, r)
+		}
+		prevLower = unicode.IsLower(r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// DefaultDisplayName suggests a display name from the player's Telegram profile
+func DefaultDisplayName(tg *TelegramUser) string {
+	if tg == nil {
+		return ""
+	}
+	if tg.Username != "" {
+		return tg.Username
+	}
+	return tg.FirstName
+}
+
+// NormalizeLanguageCode lowercases an IETF language tag such as "en" or "pt-br";
+// ok is false for anything else
+func NormalizeLanguageCode(code string) (string, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) < 2 || len(code) > 10 {
+		return "", false
+	}
+	for _, r := range code {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return "", false
+		}
+	}
+	return code, true
+}
+
+// NormalizeCountryCode uppercases an ISO 3166-1 alpha-2 country code; ok is false for anything else
+func NormalizeCountryCode(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", false
+	}
+	return code, true
+}
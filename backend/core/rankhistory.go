@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rank history resolutions
+const (
+	RankHistoryHourly = "hourly"
+	RankHistoryDaily  = "daily"
+)
+
+// RankSnapshot is a player's position on a leaderboard at a point in time
+type RankSnapshot struct {
+	Time  int64 `json:"t"`
+	Rank  int64 `json:"rank"`
+	Score int64 `json:"score"`
+}
+
+// EncodeRankSnapshot packs a snapshot into a compact "time:rank:score" zset member
+func EncodeRankSnapshot(s RankSnapshot) string {
+	return fmt.Sprintf("%d:%d:%d", s.Time, s.Rank, s.Score)
+}
+
+// ParseRankSnapshot unpacks a snapshot stored by EncodeRankSnapshot
+func ParseRankSnapshot(member string) (RankSnapshot, bool) {
+	parts := strings.Split(member, ":")
+	if len(parts) != 3 {
+		return RankSnapshot{}, false
+	}
+	t, err1 := strconv.ParseInt(parts[0], 10, 64)
+	rank, err2 := strconv.ParseInt(parts[1], 10, 64)
+	score, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return RankSnapshot{}, false
+	}
+	return RankSnapshot{Time: t, Rank: rank, Score: score}, true
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is a request budget per user for a route. Each client IP gets
+// RateLimitIPMultiplier times the budget, leaving room for players behind
+// shared addresses.
+type RateLimit struct {
+	Requests int64
+	Window   time.Duration
+}
+
+// DefaultRateLimit applies to routes missing from RouteRateLimits
+var DefaultRateLimit = RateLimit{Requests: 120, Window: time.Minute}
+
+// RouteRateLimits sets the default budget for individual routes; RATE_LIMITS
+// overrides them without a rebuild (see ParseRateLimits). Taps have their
+// own token bucket and duel cap, so the click routes only stop floods.
+var RouteRateLimits = map[string]RateLimit{
+	"/api/click":                  {Requests: 1500, Window: time.Minute},
+	"/api/click/batch":            {Requests: 120, Window: time.Minute},
+	"/api/duel/click":             {Requests: 1500, Window: time.Minute},
+	"/api/state":                  {Requests: 60, Window: time.Minute},
+	"/api/leaderboard":            {Requests: 60, Window: time.Minute},
+	"/api/per_second_leaderboard": {Requests: 30, Window: time.Minute},
+	"/api/clicks_leaderboard":     {Requests: 60, Window: time.Minute},
+	"/api/guild_leaderboard":      {Requests: 60, Window: time.Minute},
+	"/api/friends/leaderboard":    {Requests: 60, Window: time.Minute},
+	"/api/buy_producer":           {Requests: 60, Window: time.Minute},
+	"/api/upgrade_power":          {Requests: 60, Window: time.Minute},
+	"/api/gift":                   {Requests: 20, Window: time.Minute},
+	"/api/market/list":            {Requests: 30, Window: time.Minute},
+	"/api/market/buy":             {Requests: 60, Window: time.Minute},
+	"/api/donations/donate":       {Requests: 60, Window: time.Minute},
+	"/api/profile/name":           {Requests: 10, Window: time.Minute},
+	"/api/friends/add":            {Requests: 30, Window: time.Minute},
+	"/api/duel/challenge":         {Requests: 20, Window: time.Minute},
+	"/api/guild/create":           {Requests: 10, Window: time.Minute},
+	"/api/sessions/refresh":       {Requests: 10, Window: time.Minute},
+}
+
+// RateLimitDefaultRoute names the fallback budget in rate limit overrides
+const RateLimitDefaultRoute = "default"
+
+// RateLimitFor returns the per-user budget for a route: its override, its
+// entry in RouteRateLimits, or the default (which may itself be overridden)
+func RateLimitFor(route string, overrides map[string]RateLimit) RateLimit {
+	if limit, ok := overrides[route]; ok {
+		return limit
+	}
+	if limit, ok := RouteRateLimits[route]; ok {
+		return limit
+	}
+	if limit, ok := overrides[RateLimitDefaultRoute]; ok {
+		return limit
+	}
+	return DefaultRateLimit
+}
+
+// ParseRateLimits reads budget overrides written as comma-separated
+// "route=requests/window" entries, e.g. "/api/gift=10/1m,default=200/1m"
+func ParseRateLimits(s string) (map[string]RateLimit, error) {
+	limits := map[string]RateLimit{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, budget, ok := strings.Cut(entry, "=")
+		requests, window, ok2 := strings.Cut(budget, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("rate limit %q: want route=requests/window", entry)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(requests), 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("rate limit %q: invalid request count", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(window))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("rate limit %q: invalid window", entry)
+		}
+		limits[strings.TrimSpace(route)] = RateLimit{Requests: n, Window: d}
+	}
+	return limits, nil
+}
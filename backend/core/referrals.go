@@ -0,0 +1,44 @@
+package core
+
+import "strings"
+
+// ReferralStartParamPrefix prefixes the referrer's user ID in the TMA start_param
+const ReferralStartParamPrefix = "ref_"
+
+// ReferralMilestone rewards both sides once the invitee's production reaches a rate
+type ReferralMilestone struct {
+	ID             int   `json:"id"`
+	ProductionRate int   `json:"production_rate"`
+	InviterReward  int64 `json:"inviter_reward"`
+	InviteeReward  int64 `json:"invitee_reward"`
+}
+
+// ReferralMilestones lists invitee milestones in ascending order
+var ReferralMilestones = []ReferralMilestone{
+	{ID: 1, ProductionRate: 10, InviterReward: 5000, InviteeReward: 2500},
+	{ID: 2, ProductionRate: 100, InviterReward: 50000, InviteeReward: 25000},
+	{ID: 3, ProductionRate: 1000, InviterReward: 500000, InviteeReward: 250000},
+	{ID: 4, ProductionRate: 10000, InviterReward: 5000000, InviteeReward: 2500000},
+}
+
+// ReferralCode builds the start_param that attributes invitees to userID
+func ReferralCode(userID string) string {
+	return ReferralStartParamPrefix + userID
+}
+
+// ParseReferralStartParam extracts the referrer's user ID from a start_param
+func ParseReferralStartParam(startParam string) (string, bool) {
+	if !strings.HasPrefix(startParam, ReferralStartParamPrefix) {
+		return "", false
+	}
+	referrerID := strings.TrimPrefix(startParam, ReferralStartParamPrefix)
+	if referrerID == "" {
+		return "", false
+	}
+	for _, c := range referrerID {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	return referrerID, true
+}
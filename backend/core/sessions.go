@@ -0,0 +1,39 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// NewSessionToken returns a random, URL-safe bearer token
+func NewSessionToken() (string, error) {
+	b := make([]byte, SessionTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SessionPublicID derives the identifier a session is listed and revoked by,
+// so tokens never leave the request that carries them
+func SessionPublicID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NormalizeSessionDevice cleans a client-supplied device identifier. When the
+// client sends none, the user agent is hashed so a browser keeps one session.
+func NormalizeSessionDevice(deviceID string, userAgent string) string {
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		sum := sha256.Sum256([]byte(userAgent))
+		return "ua:" + hex.EncodeToString(sum[:8])
+	}
+	if len(deviceID) > SessionDeviceMaxLen {
+		deviceID = deviceID[:SessionDeviceMaxLen]
+	}
+	return deviceID
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tournament metrics
+const (
+	TournamentMetricClicks     = "clicks"
+	TournamentMetricProduction = "production"
+)
+
+// Tournament lifecycle states
+const (
+	TournamentStatusScheduled    = "scheduled"
+	TournamentStatusRegistration = "registration"
+	TournamentStatusRunning      = "running"
+	TournamentStatusFinished     = "finished"
+)
+
+// TournamentSchedule describes a recurring tournament. Instances start every
+// Period at Offset past the Unix epoch; registration opens RegistrationLead
+// before the start and closes when it begins.
+type TournamentSchedule struct {
+	ID               string
+	Name             string
+	Metric           string
+	Period           time.Duration
+	Offset           time.Duration
+	RegistrationLead time.Duration
+	Duration         time.Duration
+	EntryFee         int64
+	BasePrize        int64
+	PrizeSplit       []int // percent of the pool per placement
+}
+
+// Tournament is one scheduled instance of a TournamentSchedule
+type Tournament struct {
+	ID                  string `json:"id"`
+	ScheduleID          string `json:"schedule_id"`
+	Name                string `json:"name"`
+	Metric              string `json:"metric"`
+	RegistrationOpensAt int64  `json:"registration_opens_at"`
+	StartsAt            int64  `json:"starts_at"`
+	EndsAt              int64  `json:"ends_at"`
+	EntryFee            int64  `json:"entry_fee"`
+	PrizeSplit          []int  `json:"prize_split"`
+}
+
+// TournamentPlacement records a finished tournament result on a player's profile
+type TournamentPlacement struct {
+	TournamentID string `json:"tournament_id"`
+	Name         string `json:"name"`
+	Place        int    `json:"place"`
+	Score        int64  `json:"score"`
+	Prize        int64  `json:"prize"`
+	EndedAt      int64  `json:"ended_at"`
+}
+
+// TournamentSchedules lists the recurring tournaments
+var TournamentSchedules = []TournamentSchedule{
+	{
+		ID: "hourly_clicks", Name: "Hourly Tap Sprint", Metric: TournamentMetricClicks,
+		Period: time.Hour, RegistrationLead: 30 * time.Minute, Duration: 15 * time.Minute,
+		EntryFee: 0, BasePrize: 100000, PrizeSplit: []int{50, 30, 20},
+	},
+	{
+		ID: "daily_production", Name: "Daily Production Cup", Metric: TournamentMetricProduction,
+		Period: 24 * time.Hour, Offset: 18 * time.Hour, RegistrationLead: 6 * time.Hour, Duration: 2 * time.Hour,
+		EntryFee: 10000, BasePrize: 1000000, PrizeSplit: []int{50, 30, 20},
+	},
+	{
+		// Epoch was a Thursday: +2d18h lands on Saturday 18:00 UTC
+		ID: "weekly_clicks", Name: "Weekly Neon Marathon", Metric: TournamentMetricClicks,
+		Period: 7 * 24 * time.Hour, Offset: 66 * time.Hour, RegistrationLead: 24 * time.Hour, Duration: time.Hour,
+		EntryFee: 100000, BasePrize: 50000000, PrizeSplit: []int{40, 25, 15, 10, 10},
+	},
+}
+
+// FindTournamentSchedule looks up a schedule by ID
+func FindTournamentSchedule(id string) *TournamentSchedule {
+	for i := range TournamentSchedules {
+		if TournamentSchedules[i].ID == id {
+			return &TournamentSchedules[i]
+		}
+	}
+	return nil
+}
+
+// Instance builds the tournament starting at startsAt (unix seconds)
+func (s TournamentSchedule) Instance(startsAt int64) Tournament {
+	return Tournament{
+		ID:                  s.ID + ":" + strconv.FormatInt(startsAt, 10),
+		ScheduleID:          s.ID,
+		Name:                s.Name,
+		Metric:              s.Metric,
+		RegistrationOpensAt: startsAt - int64(s.RegistrationLead.Seconds()),
+		StartsAt:            startsAt,
+		EndsAt:              startsAt + int64(s.Duration.Seconds()),
+		EntryFee:            s.EntryFee,
+		PrizeSplit:          s.PrizeSplit,
+	}
+}
+
+// lastStart returns the most recent instance start at or before now
+func (s TournamentSchedule) lastStart(now time.Time) int64 {
+	period := int64(s.Period.Seconds())
+	offset := int64(s.Offset.Seconds())
+	elapsed := now.Unix() - offset
+	start := elapsed / period * period
+	if elapsed < 0 && elapsed%period != 0 {
+		start -= period
+	}
+	return start + offset
+}
+
+// Current returns the running instance, or the next one if none is running
+func (s TournamentSchedule) Current(now time.Time) Tournament {
+	start := s.lastStart(now)
+	if now.Unix() >= start+int64(s.Duration.Seconds()) {
+		start += int64(s.Period.Seconds())
+	}
+	return s.Instance(start)
+}
+
+// Previous returns the most recently finished instance
+func (s TournamentSchedule) Previous(now time.Time) Tournament {
+	start := s.lastStart(now)
+	if now.Unix() < start+int64(s.Duration.Seconds()) {
+		start -= int64(s.Period.Seconds())
+	}
+	return s.Instance(start)
+}
+
+// Before returns the instance that ran one period before t
+func (s TournamentSchedule) Before(t Tournament) Tournament {
+	return s.Instance(t.StartsAt - int64(s.Period.Seconds()))
+}
+
+// ParseTournamentID resolves a tournament ID back to its schedule instance
+func ParseTournamentID(id string) (*Tournament, bool) {
+	i := strings.LastIndex(id, ":")
+	if i < 0 {
+		return nil, false
+	}
+	s := FindTournamentSchedule(id[:i])
+	if s == nil {
+		return nil, false
+	}
+	startsAt, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil || s.lastStart(time.Unix(startsAt, 0)) != startsAt {
+		return nil, false
+	}
+	t := s.Instance(startsAt)
+	return &t, true
+}
+
+// Status reports where the tournament is in its lifecycle at now
+func (t Tournament) Status(now time.Time) string {
+	n := now.Unix()
+	switch {
+	case n < t.RegistrationOpensAt:
+		return TournamentStatusScheduled
+	case n < t.StartsAt:
+		return TournamentStatusRegistration
+	case n < t.EndsAt:
+		return TournamentStatusRunning
+	}
+	return TournamentStatusFinished
+}
+
+// TournamentPrize returns the prize for a 1-based place from the given pool
+func TournamentPrize(pool int64, split []int, place int) int64 {
+	if place < 1 || place > len(split) {
+		return 0
+	}
+	return pool * int64(split[place-1]) / 100
+}
@@ -10,8 +10,11 @@ type TelegramUser struct {
 }
 
 type Session struct {
+	ID string `json:"id,omitempty"`
+	Device string `json:"device,omitempty"`
 	UserID string `json:"user_id"`
 	TelegramUser *TelegramUser `json:"telegram_user,omitempty"`
 	CreatedAt int64 `json:"created_at"`
 	ExpiresAt int64 `json:"expires_at"`
+	StartParam string `json:"start_param,omitempty"`
 }
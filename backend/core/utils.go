@@ -1,6 +1,10 @@
 package core
 
-import "strings"
+import (
+    "fmt"
+    "strings"
+    "time"
+)
 
 // MaskTelegramID masks a user ID, keeping first and last 2 chars
 func MaskTelegramID(userID string) string {
@@ -12,3 +16,14 @@ func MaskTelegramID(userID string) string {
     middle := strings.Repeat("*", len(userID)-4)
     return first + middle + last
 }
+
+// DayKey formats the UTC calendar day of t for use in daily Redis keys
+func DayKey(t time.Time) string {
+    return t.UTC().Format("20060102")
+}
+
+// WeekKey formats the ISO week of t (UTC) for use in weekly Redis keys
+func WeekKey(t time.Time) string {
+    year, week := t.UTC().ISOWeek()
+    return fmt.Sprintf("%dW%02d", year, week)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Anomalies struct {
+	RDB  *redis.Client
+	Auth *Auth
+	Prod *Producers
+}
+
+func NewAnomalies(rdb *redis.Client, auth *Auth, prod *Producers) *Anomalies {
+	return &Anomalies{RDB: rdb, Auth: auth, Prod: prod}
+}
+
+// Scan samples every player's score, clicks, credits and production rate and
+// compares the growth since their previous sample against what those explain.
+// Implausible growth is recorded in score_anomalies for an admin to review.
+func (an *Anomalies) Scan() {
+	ctx := context.Background()
+	for start := int64(0); ; start += core.ScoreAnomalyBatchSize {
+		users, err := an.RDB.ZRange(ctx, "leaderboard", start, start+core.ScoreAnomalyBatchSize-1).Result()
+		if err != nil || len(users) == 0 {
+			return
+		}
+		an.scanBatch(ctx, users)
+		if len(users) < core.ScoreAnomalyBatchSize {
+			return
+		}
+	}
+}
+
+func (an *Anomalies) scanBatch(ctx context.Context, users []string) {
+	pipe := an.RDB.Pipeline()
+	prevs := make([]*redis.MapStringStringCmd, len(users))
+	counters := make([][]*redis.StringCmd, len(users))
+	for i, uid := range users {
+		prevs[i] = pipe.HGetAll(ctx, "score_sample:"+uid)
+		counters[i] = []*redis.StringCmd{
+			pipe.Get(ctx, uid),
+			pipe.Get(ctx, "clicks:"+uid),
+			pipe.Get(ctx, "score_credits:"+uid),
+			pipe.Get(ctx, "power:"+uid),
+		}
+	}
+	pipe.Exec(ctx)
+	now := time.Now().Unix()
+	write := an.RDB.Pipeline()
+	for i, uid := range users {
+		score, _ := counters[i][0].Int64()
+		clicks, _ := counters[i][1].Int64()
+		credits, _ := counters[i][2].Int64()
+		power, err := counters[i][3].Int64()
+		if err != nil { power = 1 }
+		rate, _ := an.Prod.GetTotalProduction(uid)
+		cur := core.ScoreSample{At: now, Score: score, Clicks: clicks, Credits: credits, ProductionRate: int64(rate)}
+		if prev, ok := parseScoreSample(prevs[i].Val()); ok && now-prev.At <= int64(core.ScoreAnomalyMaxWindow/time.Second) {
+			if anomaly := core.DetectScoreAnomaly(uid, prev, cur, power); anomaly != nil {
+				evidence, _ := json.Marshal(anomaly)
+				write.HSet(ctx, "score_anomalies", uid, evidence)
+				write.LPush(ctx, "score_anomaly_log:"+uid, evidence)
+				write.LTrim(ctx, "score_anomaly_log:"+uid, 0, core.ScoreAnomalyLogSize-1)
+			}
+		}
+		write.HSet(ctx, "score_sample:"+uid, "at", cur.At, "score", cur.Score, "clicks", cur.Clicks, "credits", cur.Credits, "production_rate", cur.ProductionRate)
+		write.Expire(ctx, "score_sample:"+uid, core.ScoreAnomalyMaxWindow)
+	}
+	write.Exec(ctx)
+}
+
+func parseScoreSample(h map[string]string) (core.ScoreSample, bool) {
+	if len(h) == 0 {
+		return core.ScoreSample{}, false
+	}
+	var s core.ScoreSample
+	s.At, _ = strconv.ParseInt(h["at"], 10, 64)
+	s.Score, _ = strconv.ParseInt(h["score"], 10, 64)
+	s.Clicks, _ = strconv.ParseInt(h["clicks"], 10, 64)
+	s.Credits, _ = strconv.ParseInt(h["credits"], 10, 64)
+	s.ProductionRate, _ = strconv.ParseInt(h["production_rate"], 10, 64)
+	return s, s.At > 0
+}
+
+// HandleList returns the latest anomaly of every flagged player, or with
+// ?user_id= the recorded evidence for one player
+func (an *Anomalies) HandleList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	var raw []string
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		raw, _ = an.RDB.LRange(ctx, "score_anomaly_log:"+userID, 0, -1).Result()
+	} else {
+		all, err := an.RDB.HGetAll(ctx, "score_anomalies").Result()
+		if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+		for _, v := range all {
+			raw = append(raw, v)
+		}
+	}
+	anomalies := make([]core.ScoreAnomaly, 0, len(raw))
+	for _, item := range raw {
+		var a core.ScoreAnomaly
+		if json.Unmarshal([]byte(item), &a) == nil {
+			anomalies = append(anomalies, a)
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].DetectedAt > anomalies[j].DetectedAt })
+	banned := map[string]bool{}
+	if ids, err := an.RDB.SMembers(ctx, "shadow_banned").Result(); err == nil {
+		for _, id := range ids {
+			banned[id] = true
+		}
+	}
+	out := make([]map[string]interface{}, len(anomalies))
+	for i, a := range anomalies {
+		out[i] = map[string]interface{}{"anomaly": a, "shadow_banned": banned[a.UserID]}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleDismiss clears a player's flag after review; their evidence log is kept
+func (an *Anomalies) HandleDismiss(w http.ResponseWriter, r *http.Request) {
+	var req struct { UserID string `json:"user_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	removed, err := an.RDB.HDel(context.Background(), "score_anomalies", req.UserID).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if removed == 0 { http.Error(w, "not found", http.StatusNotFound); return }
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -5,65 +5,55 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	core "neon-clicker/core"
-	initdata "github.com/telegram-mini-apps/init-data-golang"
 	"github.com/redis/go-redis/v9"
 )
 
 type Auth struct {
-	RDB      *redis.Client
-	BotToken string
+	RDB       *redis.Client
+	Providers map[string]AuthProvider
+	Admins    map[string]bool
+	// NewUserHooks run once per user, on their first authentication
+	NewUserHooks []func(ctx context.Context, session *core.Session)
 }
 
-func NewAuth(rdb *redis.Client, botToken string) *Auth {
-	return &Auth{RDB: rdb, BotToken: botToken}
+// NewAuth accepts credentials for the given providers' schemes in addition to session tokens
+func NewAuth(rdb *redis.Client, providers ...AuthProvider) *Auth {
+	a := &Auth{RDB: rdb, Providers: map[string]AuthProvider{}, Admins: map[string]bool{}}
+	for _, p := range providers {
+		a.Providers[p.Scheme()] = p
+	}
+	return a
 }
 
-// Telegram authentication functions using official library
-func (a *Auth) ValidateTelegramInitData(initDataRaw string) (*core.TelegramUser, error) {
-	// For development/testing, allow validation without bot token
-	if a.BotToken == "" {
-		fmt.Println("WARNING: Bot token not configured, skipping HMAC validation")
-		parsedData, err := initdata.Parse(initDataRaw)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse init data: %v", err)
-		}
-		telegramUser := &core.TelegramUser{
-			ID:           int(parsedData.User.ID),
-			FirstName:    parsedData.User.FirstName,
-			LastName:     parsedData.User.LastName,
-			Username:     parsedData.User.Username,
-			LanguageCode: parsedData.User.LanguageCode,
-			IsPremium:    parsedData.User.IsPremium,
+// SetAdmins grants admin API access to the given user IDs
+func (a *Auth) SetAdmins(userIDs []string) {
+	a.Admins = make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			a.Admins[id] = true
 		}
-		return telegramUser, nil
 	}
+}
 
-	// Validate init data using bot token
-	if err := initdata.Validate(initDataRaw, a.BotToken, 24*time.Hour); err != nil {
-		return nil, fmt.Errorf("init data validation failed: %v", err)
-	}
-	parsedData, err := initdata.Parse(initDataRaw)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse init data: %v", err)
-	}
-	telegramUser := &core.TelegramUser{
-		ID:           int(parsedData.User.ID),
-		FirstName:    parsedData.User.FirstName,
-		LastName:     parsedData.User.LastName,
-		Username:     parsedData.User.Username,
-		LanguageCode: parsedData.User.LanguageCode,
-		IsPremium:    parsedData.User.IsPremium,
-	}
-	return telegramUser, nil
+// IsAdmin reports whether the user may call admin endpoints
+func (a *Auth) IsAdmin(userID string) bool {
+	return a.Admins[userID]
 }
 
-func (a *Auth) CreateSession(userID string, telegramUser *core.TelegramUser) (string, error) {
-	sessionID := fmt.Sprintf("session_%d_%s", time.Now().UnixNano(), userID)
+// CreateSession stores a new session for the user's device under a random token
+func (a *Auth) CreateSession(userID string, telegramUser *core.TelegramUser, device string) (string, error) {
+	token, err := core.NewSessionToken()
+	if err != nil {
+		return "", err
+	}
 	session := core.Session{
+		ID:           core.SessionPublicID(token),
+		Device:       device,
 		UserID:       userID,
 		TelegramUser: telegramUser,
 		CreatedAt:    time.Now().Unix(),
@@ -73,10 +63,18 @@ func (a *Auth) CreateSession(userID string, telegramUser *core.TelegramUser) (st
 	if err != nil { 
 		return "", err 
 	}
-	if err := a.RDB.Set(context.Background(), "session:"+sessionID, data, core.SessionTTL).Err(); err != nil {
+	ctx := context.Background()
+	_, err = a.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "session:"+token, data, core.SessionTTL)
+		pipe.HSet(ctx, "user_sessions:"+userID, session.ID, token)
+		pipe.Expire(ctx, "user_sessions:"+userID, core.SessionTTL)
+		return nil
+	})
+	if err != nil {
 		return "", err
 	}
-	return sessionID, nil
+	a.pruneSessions(ctx, userID)
+	return token, nil
 }
 
 func (a *Auth) ValidateSession(sessionID string) (*core.Session, error) {
@@ -87,34 +85,193 @@ func (a *Auth) ValidateSession(sessionID string) (*core.Session, error) {
 	if err != nil { 
 		return nil, fmt.Errorf("invalid session") 
 	}
-	if err != nil { return nil, fmt.Errorf("invalid session") }
 	var session core.Session
 	if err := json.Unmarshal([]byte(val), &session); err != nil { return nil, fmt.Errorf("invalid session data") }
 	if time.Now().Unix() > session.ExpiresAt {
 		a.RDB.Del(context.Background(), "session:"+sessionID)
 		return nil, fmt.Errorf("session expired")
 	}
+	// Only sessions listed in the user's index are live; this also retires
+	// legacy guessable tokens, which were never indexed
+	session.ID = core.SessionPublicID(sessionID)
+	indexed, err := a.RDB.HGet(context.Background(), "user_sessions:"+session.UserID, session.ID).Result()
+	if err == redis.Nil || (err == nil && indexed != sessionID) {
+		a.RDB.Del(context.Background(), "session:"+sessionID)
+		return nil, fmt.Errorf("invalid session")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid session")
+	}
 	return &session, nil
 }
 
+// OnNewUser registers fn to run when a user authenticates for the first time
+func (a *Auth) OnNewUser(fn func(ctx context.Context, session *core.Session)) {
+	a.NewUserHooks = append(a.NewUserHooks, fn)
+}
+
+// markUserCreated records when the user first authenticated, reporting whether
+// this is their first time
+func (a *Auth) markUserCreated(ctx context.Context, userID string) bool {
+	created, err := a.RDB.SetNX(ctx, "user_created:"+userID, time.Now().Unix(), 0).Result()
+	return err == nil && created
+}
+
+// BackfillUserCreated gives every existing player a creation record, once.
+// Their real creation time is unknown, so they count from the backfill.
+func (a *Auth) BackfillUserCreated() {
+	ctx := context.Background()
+	if done, err := a.RDB.Exists(ctx, "user_created_backfilled").Result(); err != nil || done == 1 {
+		return
+	}
+	users, err := a.RDB.ZRange(ctx, "leaderboard", 0, -1).Result()
+	if err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	pipe := a.RDB.Pipeline()
+	for _, userID := range users {
+		pipe.SetNX(ctx, "user_created:"+userID, now, 0)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return
+	}
+	a.RDB.Set(ctx, "user_created_backfilled", now, 0)
+}
+
+// storedSession pairs a session with its token for server-side bookkeeping
+type storedSession struct {
+	Token   string
+	Session core.Session
+}
+
+// userSessions returns the user's live sessions, newest first, dropping index
+// entries whose session has expired
+func (a *Auth) userSessions(ctx context.Context, userID string) []storedSession {
+	index, err := a.RDB.HGetAll(ctx, "user_sessions:"+userID).Result()
+	if err != nil || len(index) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(index))
+	keys := make([]string, 0, len(index))
+	for id, token := range index {
+		ids = append(ids, id)
+		keys = append(keys, "session:"+token)
+	}
+	vals, err := a.RDB.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil
+	}
+	now := time.Now().Unix()
+	out := make([]storedSession, 0, len(vals))
+	for i, v := range vals {
+		var session core.Session
+		raw, ok := v.(string)
+		if !ok || json.Unmarshal([]byte(raw), &session) != nil || session.ExpiresAt < now {
+			a.RDB.HDel(ctx, "user_sessions:"+userID, ids[i])
+			continue
+		}
+		session.ID = ids[i]
+		out = append(out, storedSession{Token: index[ids[i]], Session: session})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Session.CreatedAt > out[j].Session.CreatedAt })
+	return out
+}
+
+// pruneSessions revokes the user's oldest sessions beyond SessionMaxPerUser
+func (a *Auth) pruneSessions(ctx context.Context, userID string) {
+	sessions := a.userSessions(ctx, userID)
+	for i := core.SessionMaxPerUser; i < len(sessions); i++ {
+		a.revoke(ctx, userID, sessions[i].Session.ID, sessions[i].Token)
+	}
+}
+
+func (a *Auth) revoke(ctx context.Context, userID string, id string, token string) {
+	a.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, "session:"+token)
+		pipe.HDel(ctx, "user_sessions:"+userID, id)
+		return nil
+	})
+}
+
+// SessionForDevice returns the user's session on this device, creating one if
+// there is none and rotating it once it is older than SessionRotateAfter
+func (a *Auth) SessionForDevice(userID string, telegramUser *core.TelegramUser, device string) (string, error) {
+	ctx := context.Background()
+	for _, s := range a.userSessions(ctx, userID) {
+		if s.Session.Device != device {
+			continue
+		}
+		if time.Since(time.Unix(s.Session.CreatedAt, 0)) < core.SessionRotateAfter {
+			return s.Token, nil
+		}
+		return a.RotateSession(s.Token)
+	}
+	return a.CreateSession(userID, telegramUser, device)
+}
+
+// RotateSession replaces a session with a fresh token for the same device and revokes the old one
+func (a *Auth) RotateSession(token string) (string, error) {
+	session, err := a.ValidateSession(token)
+	if err != nil {
+		return "", err
+	}
+	fresh, err := a.CreateSession(session.UserID, session.TelegramUser, session.Device)
+	if err != nil {
+		return "", err
+	}
+	a.revoke(context.Background(), session.UserID, session.ID, token)
+	return fresh, nil
+}
+
+// RevokeSession ends one of the user's sessions by its public ID
+func (a *Auth) RevokeSession(userID string, id string) bool {
+	ctx := context.Background()
+	token, err := a.RDB.HGet(ctx, "user_sessions:"+userID, id).Result()
+	if err != nil {
+		return false
+	}
+	a.revoke(ctx, userID, id, token)
+	return true
+}
+
+// RevokeAllSessions ends every session of the user, returning how many were revoked
+func (a *Auth) RevokeAllSessions(userID string) int {
+	ctx := context.Background()
+	sessions := a.userSessions(ctx, userID)
+	for _, s := range sessions {
+		a.revoke(ctx, userID, s.Session.ID, s.Token)
+	}
+	return len(sessions)
+}
+
+// sessionDevice identifies the device a request comes from
+func sessionDevice(r *http.Request) string {
+	return core.NormalizeSessionDevice(r.Header.Get("X-Device-ID"), r.UserAgent())
+}
+
+// AuthenticateRequest accepts a session token ("Bearer") or credentials for a
+// configured provider, such as Telegram init data ("tma"). Provider
+// credentials are verified on every request and do not create a session;
+// clients obtain one from /api/state or /api/sessions/refresh.
 func (a *Auth) AuthenticateRequest(r *http.Request) (*core.Session, error) {
-	// Check for session ID in Authorization header
 	authHeader := r.Header.Get("Authorization")
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		sessionID := strings.TrimPrefix(authHeader, "Bearer ")
-		return a.ValidateSession(sessionID)
-	}
-	// Check for Telegram init data in Authorization header
-	if strings.HasPrefix(authHeader, "tma ") {
-		initData := strings.TrimPrefix(authHeader, "tma ")
-		tg, err := a.ValidateTelegramInitData(initData)
-		if err != nil { return nil, err }
-		userID := fmt.Sprintf("%d", tg.ID)
-		sessionID, err := a.CreateSession(userID, tg)
-		if err != nil { return nil, err }
-		session := &core.Session{UserID: userID, TelegramUser: tg, CreatedAt: time.Now().Unix(), ExpiresAt: time.Now().Unix() + 7776000}
-		_ = sessionID // session stored, caller may set header if needed
-		return session, nil
-	}
-	return nil, fmt.Errorf("unauthorized")
+	scheme, credentials, _ := strings.Cut(authHeader, " ")
+	if scheme == "Bearer" {
+		return a.ValidateSession(credentials)
+	}
+	provider, ok := a.Providers[scheme]
+	if !ok || credentials == "" {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	tg, startParam, err := provider.Authenticate(r, credentials)
+	if err != nil { return nil, err }
+	userID := fmt.Sprintf("%d", tg.ID)
+	// Keep the profile's language in sync for language leaderboards
+	if lang, ok := core.NormalizeLanguageCode(tg.LanguageCode); ok {
+		setProfileScope(context.Background(), a.RDB, userID, core.LeaderboardScopeLanguage, lang)
+	}
+	now := time.Now()
+	session := &core.Session{UserID: userID, Device: sessionDevice(r), TelegramUser: tg, CreatedAt: now.Unix(), ExpiresAt: now.Add(core.SessionTTL).Unix(), StartParam: startParam}
+	return session, nil
 }
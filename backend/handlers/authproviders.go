@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	core "neon-clicker/core"
+	initdata "github.com/telegram-mini-apps/init-data-golang"
+)
+
+// AuthProvider verifies the credentials of one Authorization scheme and
+// identifies the Telegram user behind them
+type AuthProvider interface {
+	// Scheme is the Authorization header scheme the provider handles, e.g. "tma"
+	Scheme() string
+	// Authenticate returns the user and the launch start_param (empty when absent)
+	Authenticate(r *http.Request, credentials string) (*core.TelegramUser, string, error)
+}
+
+// TelegramProvider authenticates Mini App init data signed with the bot token
+type TelegramProvider struct {
+	BotToken string
+}
+
+func NewTelegramProvider(botToken string) *TelegramProvider {
+	return &TelegramProvider{BotToken: botToken}
+}
+
+func (p *TelegramProvider) Scheme() string { return "tma" }
+
+func (p *TelegramProvider) Authenticate(r *http.Request, initDataRaw string) (*core.TelegramUser, string, error) {
+	if p.BotToken == "" {
+		return nil, "", fmt.Errorf("bot token not configured")
+	}
+	if err := initdata.Validate(initDataRaw, p.BotToken, core.TelegramInitDataMaxAge); err != nil {
+		return nil, "", fmt.Errorf("init data validation failed: %v", err)
+	}
+	parsedData, err := initdata.Parse(initDataRaw)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse init data: %v", err)
+	}
+	telegramUser := &core.TelegramUser{
+		ID:           int(parsedData.User.ID),
+		FirstName:    parsedData.User.FirstName,
+		LastName:     parsedData.User.LastName,
+		Username:     parsedData.User.Username,
+		LanguageCode: parsedData.User.LanguageCode,
+		IsPremium:    parsedData.User.IsPremium,
+	}
+	return telegramUser, parsedData.StartParam, nil
+}
+
+// DevProvider lets local clients act as any test user with
+// "Authorization: dev <user_id>". It performs no verification and must only
+// be enabled outside production (see app.Config.Validate).
+type DevProvider struct{}
+
+func NewDevProvider() *DevProvider { return &DevProvider{} }
+
+func (p *DevProvider) Scheme() string { return "dev" }
+
+// Authenticate accepts any positive numeric user ID. The optional
+// X-Dev-Language and X-Dev-Start-Param headers stand in for init data fields.
+func (p *DevProvider) Authenticate(r *http.Request, userID string) (*core.TelegramUser, string, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil || id <= 0 {
+		return nil, "", fmt.Errorf("invalid dev user id")
+	}
+	lang := r.Header.Get("X-Dev-Language")
+	if lang == "" {
+		lang = "en"
+	}
+	telegramUser := &core.TelegramUser{
+		ID:           id,
+		FirstName:    "Test",
+		LastName:     "User " + userID,
+		Username:     "test" + userID,
+		LanguageCode: lang,
+	}
+	return telegramUser, r.Header.Get("X-Dev-Start-Param"), nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Buffs struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewBuffs(rdb *redis.Client, auth *Auth) *Buffs { return &Buffs{RDB: rdb, Auth: auth} }
+
+// activateCommunityBuffs starts the buffs for every tier a donation pushed the
+// goal past. Each tier fires once per goal.
+func activateCommunityBuffs(ctx context.Context, rdb *redis.Client, goal core.DonationGoal, before int64, after int64) {
+	now := time.Now()
+	for _, tier := range core.CommunityBuffTiersCrossed(before, after, goal.Target) {
+		first, err := rdb.HSetNX(ctx, "community_buff_milestones:"+strconv.Itoa(goal.ID), strconv.Itoa(tier.Percent), now.Unix()).Result()
+		if err != nil || !first {
+			continue
+		}
+		expiresAt := now.Add(tier.Duration).Unix()
+		buff, _ := json.Marshal(core.CommunityBuff{
+			GoalID:            goal.ID,
+			GoalName:          goal.Name,
+			Milestone:         tier.Percent,
+			ProductionPercent: tier.ProductionPercent,
+			StartedAt:         now.Unix(),
+			ExpiresAt:         expiresAt,
+		})
+		rdb.ZAdd(ctx, "community_buffs", redis.Z{Score: float64(expiresAt), Member: buff})
+	}
+	rdb.ZRemRangeByScore(ctx, "community_buffs", "-inf", strconv.FormatInt(now.Unix(), 10))
+}
+
+// activeCommunityBuffs returns the buffs that have not expired yet, soonest to expire first
+func activeCommunityBuffs(ctx context.Context, rdb *redis.Client) []core.CommunityBuff {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	raw, err := rdb.ZRangeByScore(ctx, "community_buffs", &redis.ZRangeBy{Min: "(" + now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil
+	}
+	buffs := make([]core.CommunityBuff, 0, len(raw))
+	for _, item := range raw {
+		var b core.CommunityBuff
+		if json.Unmarshal([]byte(item), &b) == nil {
+			buffs = append(buffs, b)
+		}
+	}
+	return buffs
+}
+
+// communityBuffPercent is the production bonus every player currently receives
+func communityBuffPercent(ctx context.Context, rdb *redis.Client) int {
+	return core.CommunityBuffPercent(activeCommunityBuffs(ctx, rdb))
+}
+
+// HandleList returns the active community buffs with their remaining time
+func (b *Buffs) HandleList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	buffs := activeCommunityBuffs(ctx, b.RDB)
+	now := time.Now().Unix()
+	type Resp struct {
+		core.CommunityBuff
+		RemainingSeconds int64 `json:"remaining_seconds"`
+	}
+	out := make([]Resp, len(buffs))
+	for i, buff := range buffs {
+		out[i] = Resp{CommunityBuff: buff, RemainingSeconds: buff.ExpiresAt - now}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"buffs": out,
+		"production_percent": core.CommunityBuffPercent(buffs),
+		"tiers": core.CommunityBuffTiers,
+	})
+}
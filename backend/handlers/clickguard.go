@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// clickBucketLua defines refillClickBucket and saveClickBucket, shared by the
+// scripts that spend click tokens. refillClickBucket returns the tokens in the user's bucket now, refilled
+// continuously at rate per second up to capacity (at throttledPercent of the
+// rate while the throttle key exists), and the effective rate.
+const clickBucketLua = `
+local function refillClickBucket(bucketKey, throttledKey, capacity, rate, throttledPercent, now)
+	if redis.call('EXISTS', throttledKey) == 1 then rate = rate * throttledPercent / 100 end
+	local b = redis.call('HMGET', bucketKey, 'tokens', 'ts')
+	local tokens = tonumber(b[1]) or capacity
+	local ts = tonumber(b[2]) or now
+	return math.min(capacity, tokens + math.max(0, now - ts) * rate / 1000), rate
+end
+
+local function saveClickBucket(bucketKey, tokens, nowArg, capacity, rate)
+	redis.call('HSET', bucketKey, 'tokens', string.format('%.3f', tokens), 'ts', nowArg)
+	redis.call('PEXPIRE', bucketKey, math.ceil(capacity * 1000 / rate) + 1000)
+end
+`
+
+// clickBucketScript takes ARGV[4] tokens from the user's click bucket.
+// KEYS: click_bucket:<uid>, click_throttled:<uid>
+// ARGV: capacity, refill per second, now (ms), cost, throttled percent
+// Returns {1, 0} when allowed or {0, retryAfterMs} when the bucket is short.
+var clickBucketScript = redis.NewScript(clickBucketLua + `
+local capacity = tonumber(ARGV[1])
+local cost = tonumber(ARGV[4])
+local tokens, rate = refillClickBucket(KEYS[1], KEYS[2], capacity, tonumber(ARGV[2]), tonumber(ARGV[5]), tonumber(ARGV[3]))
+local allowed, wait = 0, 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	wait = math.ceil((cost - tokens) * 1000 / rate)
+end
+saveClickBucket(KEYS[1], tokens, ARGV[3], capacity, rate)
+return {allowed, wait}
+`)
+
+// takeClickTokens spends clicks from the user's token bucket. When the bucket
+// is short nothing is spent and retryAfter says when the clicks would fit;
+// sustained hammering earns a strike.
+func takeClickTokens(ctx context.Context, rdb *redis.Client, userID string, clicks int64) (bool, time.Duration) {
+	keys := []string{"click_bucket:" + userID, "click_throttled:" + userID}
+	res, err := clickBucketScript.Run(ctx, rdb, keys, core.ClickBucketCapacity, core.ClickRefillPerSecond, time.Now().UnixMilli(), clicks, core.ClickThrottledPercent).Int64Slice()
+	if err != nil {
+		// Fail open: a Redis hiccup should not stop legitimate play
+		return true, 0
+	}
+	if res[0] == 1 {
+		return true, 0
+	}
+	countClickRejects(ctx, rdb, userID, clicks)
+	return false, time.Duration(res[1]) * time.Millisecond
+}
+
+// countClickRejects tallies clicks refused by the bucket over the last minute,
+// issuing a strike each time the tally passes ClickRejectsPerStrike
+func countClickRejects(ctx context.Context, rdb *redis.Client, userID string, rejected int64) {
+	rejects, err := rdb.IncrBy(ctx, "click_rejects:"+userID, rejected).Result()
+	if err != nil {
+		return
+	}
+	if rejects == rejected {
+		rdb.Expire(ctx, "click_rejects:"+userID, time.Minute)
+	}
+	if (rejects-rejected)/core.ClickRejectsPerStrike < rejects/core.ClickRejectsPerStrike {
+		addClickStrike(ctx, rdb, userID, core.ClickStrikeRateLimit)
+	}
+}
+
+// writeClickThrottled rejects clicks that did not fit the user's bucket
+func writeClickThrottled(w http.ResponseWriter, retry time.Duration) {
+	rateLimitRejectedBy.Add("clicks", 1)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.FormatInt(int64((retry+time.Second-1)/time.Second), 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": "too many clicks", "retry_after_ms": retry.Milliseconds()})
+}
+
+// recordClickTimes adds tap timestamps (unix ms) to the user's sample and
+// checks the sample for machine-like regularity whenever the user's click
+// count passes a multiple of ClickRegularityCheckEvery
+func recordClickTimes(ctx context.Context, rdb *redis.Client, userID string, times []int64, clicks int64) {
+	if len(times) == 0 {
+		return
+	}
+	key := "click_times:" + userID
+	values := make([]interface{}, len(times))
+	for i, t := range times {
+		values[i] = t
+	}
+	pipe := rdb.Pipeline()
+	pipe.LPush(ctx, key, values...)
+	pipe.LTrim(ctx, key, 0, core.ClickSampleSize-1)
+	pipe.Expire(ctx, key, time.Hour)
+	pipe.Exec(ctx)
+	before := clicks - int64(len(times))
+	if before/core.ClickRegularityCheckEvery == clicks/core.ClickRegularityCheckEvery {
+		return
+	}
+	raw, err := rdb.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	sample := make([]int64, 0, len(raw))
+	for _, v := range raw {
+		if t, err := strconv.ParseInt(v, 10, 64); err == nil {
+			sample = append(sample, t)
+		}
+	}
+	if core.ClickIntervalsSuspicious(sample) {
+		addClickStrike(ctx, rdb, userID, core.ClickStrikeRegularity)
+		// Start a fresh sample so one burst counts once
+		rdb.Del(ctx, key)
+	}
+}
+
+// addClickStrike records a strike. Enough strikes throttle the user's click
+// rate; more exclude them from leaderboards until an admin reviews them.
+func addClickStrike(ctx context.Context, rdb *redis.Client, userID string, reason string) {
+	strikes, err := rdb.Incr(ctx, "click_strikes:"+userID).Result()
+	if err != nil {
+		return
+	}
+	rdb.Expire(ctx, "click_strikes:"+userID, core.ClickStrikeDecay)
+	if strikes >= core.ClickStrikesThrottle {
+		rdb.Set(ctx, "click_throttled:"+userID, reason, core.ClickThrottleDuration)
+	}
+	if strikes >= core.ClickStrikesFlag {
+		flag, _ := json.Marshal(core.ClickFlag{UserID: userID, Strikes: strikes, Reason: reason, FlaggedAt: time.Now().Unix()})
+		rdb.HSet(ctx, "click_flags", userID, flag)
+		excludeFromLeaderboards(ctx, rdb, userID, core.LeaderboardExclusionClicks)
+	}
+}
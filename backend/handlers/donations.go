@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	core "neon-clicker/core"
 	"github.com/redis/go-redis/v9"
@@ -17,9 +18,155 @@ type Donations struct {
 
 func NewDonations(rdb *redis.Client, auth *Auth) *Donations { return &Donations{RDB: rdb, Auth: auth} }
 
-func (d *Donations) getDonationTotals(ctx context.Context) (map[int]int64, error) {
+// donateScript moves score into an active goal, capping the donation at what
+// the goal still needs and marking the goal completed when it reaches its target.
+// KEYS: user, leaderboard, donation_goal_total:<id>, donation_goal_donors:<id>, donation_goal_status, donation_goal_completed_at
+// ARGV: amount, target, goal ID, now
+// Returns {donated, newScore, newTotal, completed}, or {-1,...} goal not active, {-2,score,...} insufficient score.
+var donateScript = redis.NewScript(`
+if redis.call('HGET', KEYS[5], ARGV[3]) ~= 'active' then return {-1, 0, 0, 0} end
+local target = tonumber(ARGV[2])
+local total = tonumber(redis.call('GET', KEYS[3]) or '0')
+local amount = math.min(tonumber(ARGV[1]), target - total)
+if amount <= 0 then return {-1, 0, 0, 0} end
+local score = tonumber(redis.call('GET', KEYS[1]) or '0')
+if score < amount then return {-2, score, 0, 0} end
+amount = string.format('%d', amount)
+local newScore = redis.call('DECRBY', KEYS[1], amount)
+redis.call('ZADD', KEYS[2], newScore, KEYS[1])
+local newTotal = redis.call('INCRBY', KEYS[3], amount)
+redis.call('ZINCRBY', KEYS[4], amount, KEYS[1])
+local completed = 0
+if newTotal >= target then
+	redis.call('HSET', KEYS[5], ARGV[3], 'completed')
+	redis.call('HSET', KEYS[6], ARGV[3], ARGV[4])
+	completed = 1
+end
+return {tonumber(amount), newScore, newTotal, completed}
+`)
+
+// transitionGoalScript moves a goal to a new lifecycle state if it is currently
+// in one of the allowed states. Goals without a stored state count as locked.
+// KEYS: donation_goal_status, donation_goal_completed_at
+// ARGV: goal ID, new status, end time (0 to leave unset), allowed current statuses...
+// Returns 1 when the goal moved, 0 otherwise.
+var transitionGoalScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1]) or 'locked'
+for i = 4, #ARGV do
+	if current == ARGV[i] then
+		redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+		if ARGV[3] ~= '0' then
+			redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+		end
+		return 1
+	end
+end
+return 0
+`)
+
+// transitionGoal moves a goal between lifecycle states; endedAt is recorded
+// (for archiving) when non-zero
+func (d *Donations) transitionGoal(ctx context.Context, id int, to string, endedAt int64, from ...string) bool {
+	args := []interface{}{id, to, endedAt}
+	for _, f := range from {
+		args = append(args, f)
+	}
+	moved, err := transitionGoalScript.Run(ctx, d.RDB, []string{"donation_goal_status", "donation_goal_completed_at"}, args...).Int()
+	return err == nil && moved == 1
+}
+
+// parseGoal builds a goal from its donation_goal:<id> hash
+func parseGoal(id int, data map[string]string) *core.DonationGoal {
+	if len(data) == 0 {
+		return nil
+	}
+	target, _ := strconv.ParseInt(data["target"], 10, 64)
+	startsAt, _ := strconv.ParseInt(data["starts_at"], 10, 64)
+	endsAt, _ := strconv.ParseInt(data["ends_at"], 10, 64)
+	createdAt, _ := strconv.ParseInt(data["created_at"], 10, 64)
+	return &core.DonationGoal{
+		ID:          id,
+		Name:        data["name"],
+		Target:      target,
+		Description: data["description"],
+		ImageURL:    data["image_url"],
+		StartsAt:    startsAt,
+		EndsAt:      endsAt,
+		CreatedAt:   createdAt,
+	}
+}
+
+// loadGoal looks up a donation goal by ID; nil when it does not exist
+func (d *Donations) loadGoal(ctx context.Context, id int) *core.DonationGoal {
+	data, err := d.RDB.HGetAll(ctx, "donation_goal:"+strconv.Itoa(id)).Result()
+	if err != nil {
+		return nil
+	}
+	return parseGoal(id, data)
+}
+
+// loadGoals returns every stored goal in unlock order
+func (d *Donations) loadGoals(ctx context.Context) []core.DonationGoal {
+	ids, err := d.RDB.ZRange(ctx, "donation_goals", 0, -1).Result()
+	if err != nil {
+		return nil
+	}
+	pipe := d.RDB.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, "donation_goal:"+id)
+	}
+	pipe.Exec(ctx)
+	goals := make([]core.DonationGoal, 0, len(ids))
+	for i, idStr := range ids {
+		id, _ := strconv.Atoi(idStr)
+		if goal := parseGoal(id, cmds[i].Val()); goal != nil {
+			goals = append(goals, *goal)
+		}
+	}
+	return goals
+}
+
+// saveGoal writes a goal's definition and indexes it in unlock order
+func (d *Donations) saveGoal(ctx context.Context, goal core.DonationGoal) error {
+	key := strconv.Itoa(goal.ID)
+	_, err := d.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, "donation_goal:"+key, map[string]interface{}{
+			"name":        goal.Name,
+			"target":      goal.Target,
+			"description": goal.Description,
+			"image_url":   goal.ImageURL,
+			"starts_at":   goal.StartsAt,
+			"ends_at":     goal.EndsAt,
+			"created_at":  goal.CreatedAt,
+		})
+		pipe.ZAdd(ctx, "donation_goals", redis.Z{Score: float64(goal.ID), Member: key})
+		return nil
+	})
+	return err
+}
+
+// seedGoals stores core.DefaultDonationGoals the first time the server runs
+func (d *Donations) seedGoals(ctx context.Context) {
+	maxID := 0
+	now := time.Now().Unix()
+	for _, g := range core.DefaultDonationGoals {
+		if g.ID > maxID {
+			maxID = g.ID
+		}
+		exists, err := d.RDB.Exists(ctx, "donation_goal:"+strconv.Itoa(g.ID)).Result()
+		if err != nil || exists == 1 {
+			continue
+		}
+		g.CreatedAt = now
+		d.saveGoal(ctx, g)
+	}
+	d.RDB.SetNX(ctx, "donation_goal_next_id", maxID, 0)
+}
+
+func (d *Donations) getDonationTotals(ctx context.Context, goals []core.DonationGoal) (map[int]int64, error) {
 	totals := make(map[int]int64)
-	for _, g := range core.DonationGoals {
+	for _, g := range goals {
 		v, err := d.RDB.Get(ctx, "donation_goal_total:"+strconv.Itoa(g.ID)).Int64()
 		if err != nil {
 			totals[g.ID] = 0
@@ -30,115 +177,360 @@ func (d *Donations) getDonationTotals(ctx context.Context) (map[int]int64, error
 	return totals, nil
 }
 
-func (d *Donations) HandleListGoals(w http.ResponseWriter, r *http.Request) {
-	_, err := d.Auth.AuthenticateRequest(r)
+// getGoalStatuses returns each goal's lifecycle state
+func (d *Donations) getGoalStatuses(ctx context.Context, goals []core.DonationGoal) map[int]string {
+	raw, _ := d.RDB.HGetAll(ctx, "donation_goal_status").Result()
+	statuses := make(map[int]string, len(goals))
+	for _, g := range goals {
+		status := raw[strconv.Itoa(g.ID)]
+		if status == "" {
+			status = core.DonationGoalLocked
+		}
+		statuses[g.ID] = status
+	}
+	return statuses
+}
+
+// goalStatus returns a single goal's lifecycle state
+func (d *Donations) goalStatus(ctx context.Context, goal core.DonationGoal) string {
+	return d.getGoalStatuses(ctx, []core.DonationGoal{goal})[goal.ID]
+}
+
+// InitGoals seeds the default goals and assigns lifecycle states to goals that
+// predate them: goals already at their target are completed (and paid out) and
+// the first unfinished goal is activated; the rest stay locked until unlocked in order.
+func (d *Donations) InitGoals() {
+	ctx := context.Background()
+	d.seedGoals(ctx)
+	goals := d.loadGoals(ctx)
+	totals, _ := d.getDonationTotals(ctx, goals)
+	statuses := d.getGoalStatuses(ctx, goals)
+	now := time.Now().Unix()
+	for _, g := range goals {
+		status := statuses[g.ID]
+		if totals[g.ID] >= g.Target && (status == core.DonationGoalLocked || status == core.DonationGoalActive) {
+			key := strconv.Itoa(g.ID)
+			d.RDB.HSet(ctx, "donation_goal_status", key, core.DonationGoalCompleted)
+			d.RDB.HSet(ctx, "donation_goal_completed_at", key, now)
+			d.completeGoal(ctx, g)
+		}
+	}
+	d.SweepGoals()
+}
+
+// unlockNextGoal activates the first locked goal unless a campaign is already active
+func (d *Donations) unlockNextGoal(ctx context.Context) {
+	goals := d.loadGoals(ctx)
+	statuses := d.getGoalStatuses(ctx, goals)
+	for _, g := range goals {
+		if statuses[g.ID] == core.DonationGoalActive {
+			return
+		}
+	}
+	for _, g := range goals {
+		if statuses[g.ID] == core.DonationGoalLocked {
+			d.transitionGoal(ctx, g.ID, core.DonationGoalActive, 0, core.DonationGoalLocked)
+			return
+		}
+	}
+}
+
+// SweepGoals starts scheduled campaigns whose start time has come, closes
+// time-limited campaigns that have ended, finishes interrupted payouts,
+// archives goals that ended more than core.DonationGoalArchiveAfter ago and
+// unlocks the next queued goal
+func (d *Donations) SweepGoals() {
+	ctx := context.Background()
+	goals := d.loadGoals(ctx)
+	statuses := d.getGoalStatuses(ctx, goals)
+	endedAt, _ := d.RDB.HGetAll(ctx, "donation_goal_completed_at").Result()
+	now := time.Now().Unix()
+	archiveBefore := time.Now().Add(-core.DonationGoalArchiveAfter).Unix()
+	active := false
+	for _, g := range goals {
+		if statuses[g.ID] == core.DonationGoalActive && !core.DonationGoalEnded(g, now) {
+			active = true
+		}
+	}
+	for _, g := range goals {
+		status := statuses[g.ID]
+		if status == core.DonationGoalCompleted {
+			if rewarded, err := d.RDB.Exists(ctx, "donation_goal_rewarded:"+strconv.Itoa(g.ID)).Result(); err == nil && rewarded == 0 {
+				d.completeGoal(ctx, g)
+			}
+		}
+		if status == core.DonationGoalCompleted || status == core.DonationGoalClosed {
+			if ts, err := strconv.ParseInt(endedAt[strconv.Itoa(g.ID)], 10, 64); err == nil && ts < archiveBefore {
+				d.transitionGoal(ctx, g.ID, core.DonationGoalArchived, 0, status)
+			}
+			continue
+		}
+		switch status {
+		case core.DonationGoalScheduled:
+			if g.StartsAt > now {
+				continue
+			}
+			// A scheduled goal due while another campaign runs waits in the queue
+			if active {
+				d.transitionGoal(ctx, g.ID, core.DonationGoalLocked, 0, core.DonationGoalScheduled)
+			} else if d.transitionGoal(ctx, g.ID, core.DonationGoalActive, 0, core.DonationGoalScheduled) {
+				active = true
+			}
+		case core.DonationGoalActive:
+			if core.DonationGoalEnded(g, now) {
+				d.transitionGoal(ctx, g.ID, core.DonationGoalClosed, now, core.DonationGoalActive)
+			}
+		}
+	}
+	d.unlockNextGoal(ctx)
+}
+
+// donationRewardScript pays one contributor's share of a completed goal's
+// reward pool, once: donation_goal_paid:<id> remembers who was paid.
+// KEYS: donation_goal_paid:<id>, user, leaderboard, donation_goal_rewards:<id>, score_credits:<uid>
+// ARGV: reward
+// Returns 1 when paid now, 0 when already paid.
+var donationRewardScript = redis.NewScript(`
+if redis.call('SADD', KEYS[1], KEYS[2]) == 0 then return 0 end
+local score = redis.call('INCRBY', KEYS[2], ARGV[1])
+redis.call('INCRBY', KEYS[5], ARGV[1])
+redis.call('ZADD', KEYS[3], score, KEYS[2])
+redis.call('HSET', KEYS[4], KEYS[2], ARGV[1])
+return 1
+`)
+
+// completeGoal shares the goal's reward pool among its contributors in
+// proportion to what they donated, then unlocks the next goal. Each donor is
+// paid at most once, so an interrupted payout is finished by SweepGoals; the
+// goal is marked rewarded once every donor is paid.
+func (d *Donations) completeGoal(ctx context.Context, goal core.DonationGoal) {
+	key := strconv.Itoa(goal.ID)
+	total, err := d.RDB.Get(ctx, "donation_goal_total:"+key).Int64()
+	if err != nil && err != redis.Nil {
+		return
+	}
+	pool := core.DonationGoalRewardPool(goal.Target)
+	donors, err := d.RDB.ZRangeWithScores(ctx, "donation_goal_donors:"+key, 0, -1).Result()
 	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
 		return
 	}
+	for _, z := range donors {
+		uid := z.Member.(string)
+		reward := core.DonationReward(pool, int64(z.Score), total)
+		if reward <= 0 {
+			continue
+		}
+		keys := []string{"donation_goal_paid:" + key, uid, "leaderboard", "donation_goal_rewards:" + key, "score_credits:" + uid}
+		if err := donationRewardScript.Run(ctx, d.RDB, keys, reward).Err(); err != nil {
+			return
+		}
+	}
+	d.RDB.Set(ctx, "donation_goal_rewarded:"+key, time.Now().Unix(), 0)
+	d.unlockNextGoal(ctx)
+}
+
+func (d *Donations) HandleListGoals(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	totals, _ := d.getDonationTotals(ctx)
+	goals := d.loadGoals(ctx)
+	totals, _ := d.getDonationTotals(ctx, goals)
+	statuses := d.getGoalStatuses(ctx, goals)
+	now := time.Now().Unix()
 	type Resp struct {
-		ID int `json:"id"`
-		Name string `json:"name"`
-		Target int64 `json:"target"`
+		core.DonationGoal
 		TotalDonated int64 `json:"total_donated"`
 		Percent float64 `json:"percent"`
+		Status string `json:"status"`
+		RewardPool int64 `json:"reward_pool"`
 	}
-	var out []Resp
-	for _, g := range core.DonationGoals {
+	out := []Resp{}
+	// Only campaigns currently accepting donations are listed
+	for _, g := range goals {
+		if statuses[g.ID] != core.DonationGoalActive || core.DonationGoalEnded(g, now) {
+			continue
+		}
 		td := totals[g.ID]
 		p := 0.0
 		if g.Target > 0 {
 			p = float64(td) / float64(g.Target) * 100.0
 		}
-		out = append(out, Resp{ID: g.ID, Name: g.Name, Target: g.Target, TotalDonated: td, Percent: p})
+		out = append(out, Resp{DonationGoal: g, TotalDonated: td, Percent: p, Status: statuses[g.ID], RewardPool: core.DonationGoalRewardPool(g.Target)})
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
 }
 
-func (d *Donations) HandleGetGoal(w http.ResponseWriter, r *http.Request) {
-	session, err := d.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
-	ctx := context.Background()
-	currentUserID := session.UserID
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
-	id, err := strconv.Atoi(idStr)
-	if err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
-	var goal *core.DonationGoal
-	for i := range core.DonationGoals {
-		if core.DonationGoals[i].ID == id { goal = &core.DonationGoals[i]; break }
-	}
-	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
-	total, _ := d.RDB.Get(ctx, "donation_goal_total:"+strconv.Itoa(goal.ID)).Int64()
+// goalDetail builds the goal payload shared by HandleGetGoal and HandleDonate
+func (d *Donations) goalDetail(ctx context.Context, goal *core.DonationGoal, currentUserID string) map[string]interface{} {
+	key := strconv.Itoa(goal.ID)
+	total, _ := d.RDB.Get(ctx, "donation_goal_total:"+key).Int64()
 	p := 0.0
 	if goal.Target > 0 { p = float64(total) / float64(goal.Target) * 100.0 }
-	donors, _ := d.RDB.ZRevRangeWithScores(ctx, "donation_goal_donors:"+strconv.Itoa(goal.ID), 0, 9).Result()
-	type Donor struct { UserID string `json:"user_id"`; Amount int64 `json:"amount"`; IsSelf bool `json:"is_self"` }
+	donors, _ := d.RDB.ZRevRangeWithScores(ctx, visibleBoard(ctx, d.RDB, "donation_goal_donors:"+key, currentUserID), 0, 9).Result()
+	type Donor struct { UserID string `json:"user_id"`; DisplayName string `json:"display_name"`; Amount int64 `json:"amount"`; IsSelf bool `json:"is_self"` }
+	ids := make([]string, len(donors))
+	for i, z := range donors {
+		ids[i] = z.Member.(string)
+	}
+	names := displayNames(ctx, d.RDB, ids)
 	var top []Donor
 	for _, z := range donors {
 		uid := z.Member.(string)
-		top = append(top, Donor{UserID: core.MaskTelegramID(uid), Amount: int64(z.Score), IsSelf: uid == currentUserID})
+		top = append(top, Donor{UserID: core.MaskTelegramID(uid), DisplayName: publicName(names, uid), Amount: int64(z.Score), IsSelf: uid == currentUserID})
 	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	myReward, _ := d.RDB.HGet(ctx, "donation_goal_rewards:"+key, currentUserID).Int64()
+	return map[string]interface{}{
 		"id": goal.ID,
 		"name": goal.Name,
 		"target": goal.Target,
+		"description": goal.Description,
+		"image_url": goal.ImageURL,
+		"starts_at": goal.StartsAt,
+		"ends_at": goal.EndsAt,
 		"total_donated": total,
 		"percent": p,
+		"status": d.goalStatus(ctx, *goal),
+		"reward_pool": core.DonationGoalRewardPool(goal.Target),
+		"my_reward": myReward,
 		"top_donors": top,
-	})
+	}
+}
+
+func (d *Donations) HandleGetGoal(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	id, err := strconv.Atoi(idStr)
+	if err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	goal := d.loadGoal(ctx, id)
+	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
+	json.NewEncoder(w).Encode(d.goalDetail(ctx, goal, session.UserID))
 }
 
 func (d *Donations) HandleDonate(w http.ResponseWriter, r *http.Request) {
-	session, err := d.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
+	session := CurrentSession(r)
 	ctx := context.Background()
-	var req struct { GoalID int `json:"goal_id"`; Percent int `json:"percent"` }
+	// Either an exact amount or one of the preset percentages of the current score
+	var req struct { GoalID int `json:"goal_id"`; Amount int64 `json:"amount"`; Percent int `json:"percent"` }
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GoalID == 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
-	if req.Percent != 10 && req.Percent != 25 && req.Percent != 50 && req.Percent != 100 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if req.Amount < 0 || (req.Amount > 0 && req.Percent != 0) { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if req.Amount == 0 && req.Percent != 10 && req.Percent != 25 && req.Percent != 50 && req.Percent != 100 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	// Validate the goal before touching the balance
+	goal := d.loadGoal(ctx, req.GoalID)
+	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
+	if core.DonationGoalEnded(*goal, time.Now().Unix()) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "campaign has ended", "status": core.DonationGoalClosed})
+		return
+	}
+	if status := d.goalStatus(ctx, *goal); status != core.DonationGoalActive {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "goal is not accepting donations", "status": status})
+		return
+	}
 	userID := session.UserID
-	score, _ := d.RDB.Get(ctx, userID).Int()
-	if score <= 0 { json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score"}); return }
-	amount := int64(score * req.Percent / 100)
+	amount := req.Amount
+	if amount == 0 {
+		score, _ := d.RDB.Get(ctx, userID).Int64()
+		amount = score * int64(req.Percent) / 100
+	}
 	if amount <= 0 { json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score"}); return }
-	newScore, err := d.RDB.DecrBy(ctx, userID, amount).Result()
+	goalKey := strconv.Itoa(goal.ID)
+	keys := []string{userID, "leaderboard", "donation_goal_total:" + goalKey, "donation_goal_donors:" + goalKey, "donation_goal_status", "donation_goal_completed_at"}
+	res, err := donateScript.Run(ctx, d.RDB, keys, amount, goal.Target, goal.ID, time.Now().Unix()).Int64Slice()
 	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
-	d.RDB.ZAdd(ctx, "leaderboard", redis.Z{Score: float64(newScore), Member: userID})
-	goalKey := "donation_goal_total:" + strconv.Itoa(req.GoalID)
-	donorsKey := "donation_goal_donors:" + strconv.Itoa(req.GoalID)
-	total, _ := d.RDB.IncrBy(ctx, goalKey, amount).Result()
-	d.RDB.ZIncrBy(ctx, donorsKey, float64(amount), userID)
-	var goal *core.DonationGoal
-	for i := range core.DonationGoals { if core.DonationGoals[i].ID == req.GoalID { goal = &core.DonationGoals[i]; break } }
-	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
-	p := 0.0
-	if goal.Target > 0 { p = float64(total) / float64(goal.Target) * 100.0 }
-	donors, _ := d.RDB.ZRevRangeWithScores(ctx, donorsKey, 0, 9).Result()
-	type Donor2 struct { UserID string `json:"user_id"`; Amount int64 `json:"amount"`; IsSelf bool `json:"is_self"` }
-	var top []Donor2
-	for _, z := range donors {
-		uid := z.Member.(string)
-		top = append(top, Donor2{UserID: core.MaskTelegramID(uid), Amount: int64(z.Score), IsSelf: uid == session.UserID})
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "goal is not accepting donations"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score"})
+		return
+	}
+	now := time.Now().Unix()
+	entry, _ := json.Marshal(core.Donation{GoalID: goal.ID, GoalName: goal.Name, Amount: res[0], CreatedAt: now})
+	d.RDB.LPush(ctx, "donation_history:"+userID, entry)
+	d.RDB.LTrim(ctx, "donation_history:"+userID, 0, core.DonationHistorySize-1)
+	d.RDB.IncrBy(ctx, "donation_user_total:"+userID, res[0])
+	activateCommunityBuffs(ctx, d.RDB, *goal, res[2]-res[0], res[2])
+	completed := res[3] == 1
+	if completed {
+		d.completeGoal(ctx, *goal)
 	}
+	// Completion rewards may have credited the donor, so re-read their score
+	newScore, err := d.RDB.Get(ctx, userID).Int64()
+	if err != nil { newScore = res[1] }
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"score": int(newScore),
-		"goal": map[string]interface{}{
-			"id": goal.ID,
-			"name": goal.Name,
-			"target": goal.Target,
-			"total_donated": total,
-			"percent": p,
-			"top_donors": top,
-		},
+		"donated": res[0],
+		"completed": completed,
+		"goal": d.goalDetail(ctx, goal, userID),
+	})
+}
+
+// HandleHistory returns the caller's recent donations and lifetime total
+func (d *Donations) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	raw, err := d.RDB.LRange(ctx, "donation_history:"+userID, 0, core.DonationHistorySize-1).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	history := make([]core.Donation, 0, len(raw))
+	for _, item := range raw {
+		var entry core.Donation
+		if json.Unmarshal([]byte(item), &entry) == nil {
+			history = append(history, entry)
+		}
+	}
+	total, _ := d.RDB.Get(ctx, "donation_user_total:"+userID).Int64()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"donations": history,
+		"total_donated": total,
+	})
+}
+
+// HandleDonors returns a page of a goal's donor ranking plus the caller's own rank
+func (d *Donations) HandleDonors(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	q := r.URL.Query()
+	id, err := strconv.Atoi(q.Get("id"))
+	if err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	goal := d.loadGoal(ctx, id)
+	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
+	offset, _ := strconv.ParseInt(q.Get("offset"), 10, 64)
+	if offset < 0 { offset = 0 }
+	limit, err := strconv.ParseInt(q.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 { limit = core.DonorsPageSize }
+	if limit > core.DonorsMaxPageSize { limit = core.DonorsMaxPageSize }
+	currentUserID := session.UserID
+	donorsKey := visibleBoard(ctx, d.RDB, "donation_goal_donors:"+strconv.Itoa(goal.ID), currentUserID)
+	results, err := d.RDB.ZRevRangeWithScores(ctx, donorsKey, offset, offset+limit-1).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	type Donor struct { Rank int64 `json:"rank"`; UserID string `json:"user_id"`; DisplayName string `json:"display_name"`; Amount int64 `json:"amount"`; IsSelf bool `json:"is_self"` }
+	ids := make([]string, 0, len(results)+1)
+	for _, z := range results {
+		ids = append(ids, z.Member.(string))
+	}
+	names := displayNames(ctx, d.RDB, append(ids, currentUserID))
+	donors := make([]Donor, len(results))
+	for i, z := range results {
+		uid := z.Member.(string)
+		donors[i] = Donor{Rank: offset + int64(i) + 1, UserID: core.MaskTelegramID(uid), DisplayName: publicName(names, uid), Amount: int64(z.Score), IsSelf: uid == currentUserID}
+	}
+	total, _ := d.RDB.ZCard(ctx, donorsKey).Result()
+	var self *Donor
+	if amount, err := d.RDB.ZScore(ctx, donorsKey, currentUserID).Result(); err == nil {
+		rank, _ := d.RDB.ZRevRank(ctx, donorsKey, currentUserID).Result()
+		self = &Donor{Rank: rank + 1, UserID: core.MaskTelegramID(currentUserID), DisplayName: publicName(names, currentUserID), Amount: int64(amount), IsSelf: true}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"goal_id": goal.ID,
+		"donors": donors,
+		"total": total,
+		"offset": offset,
+		"limit": limit,
+		"self": self,
 	})
 }
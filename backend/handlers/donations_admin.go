@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	core "neon-clicker/core"
+)
+
+// validateGoal checks a campaign definition, returning a message describing the first problem
+func validateGoal(goal core.DonationGoal, now int64) string {
+	if n := utf8.RuneCountInString(goal.Name); n == 0 || n > core.DonationGoalNameMaxLength {
+		return "invalid name"
+	}
+	if goal.Target <= 0 {
+		return "target must be positive"
+	}
+	if utf8.RuneCountInString(goal.Description) > core.DonationGoalDescMaxLength {
+		return "description too long"
+	}
+	if goal.ImageURL != "" {
+		u, err := url.Parse(goal.ImageURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(goal.ImageURL) > core.DonationGoalImageMaxLength {
+			return "invalid image url"
+		}
+	}
+	if goal.StartsAt < 0 || goal.EndsAt < 0 {
+		return "invalid schedule"
+	}
+	if goal.EndsAt > 0 && (goal.EndsAt <= now || goal.EndsAt <= goal.StartsAt) {
+		return "end time must be in the future and after the start time"
+	}
+	return ""
+}
+
+// adminGoalView summarizes a goal with its state and progress for the admin API
+func (d *Donations) adminGoalView(ctx context.Context, goal core.DonationGoal, status string) map[string]interface{} {
+	key := strconv.Itoa(goal.ID)
+	total, _ := d.RDB.Get(ctx, "donation_goal_total:"+key).Int64()
+	donors, _ := d.RDB.ZCard(ctx, "donation_goal_donors:"+key).Result()
+	return map[string]interface{}{
+		"goal": goal,
+		"status": status,
+		"total_donated": total,
+		"donors": donors,
+	}
+}
+
+// HandleAdminList returns every campaign, including locked, scheduled and ended ones
+func (d *Donations) HandleAdminList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	goals := d.loadGoals(ctx)
+	statuses := d.getGoalStatuses(ctx, goals)
+	out := make([]map[string]interface{}, 0, len(goals))
+	for _, g := range goals {
+		out = append(out, d.adminGoalView(ctx, g, statuses[g.ID]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleAdminCreate creates a campaign. Only one campaign runs at a time: a goal
+// without starts_at starts immediately when none is active and otherwise
+// queues behind the earlier goals (as it does when created with queued).
+func (d *Donations) HandleAdminCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string `json:"name"`
+		Target      int64  `json:"target"`
+		Description string `json:"description"`
+		ImageURL    string `json:"image_url"`
+		StartsAt    int64  `json:"starts_at"`
+		EndsAt      int64  `json:"ends_at"`
+		Queued      bool   `json:"queued"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	now := time.Now().Unix()
+	goal := core.DonationGoal{
+		Name:        strings.Join(strings.Fields(req.Name), " "),
+		Target:      req.Target,
+		Description: strings.TrimSpace(req.Description),
+		ImageURL:    strings.TrimSpace(req.ImageURL),
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		CreatedAt:   now,
+	}
+	if msg := validateGoal(goal, now); msg != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": msg})
+		return
+	}
+	if req.Queued && req.StartsAt > 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "queued goals cannot have a start time"})
+		return
+	}
+	ctx := context.Background()
+	id, err := d.RDB.Incr(ctx, "donation_goal_next_id").Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	goal.ID = int(id)
+	status := core.DonationGoalLocked
+	if goal.StartsAt > now {
+		status = core.DonationGoalScheduled
+	}
+	if err := d.saveGoal(ctx, goal); err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	d.RDB.HSet(ctx, "donation_goal_status", strconv.Itoa(goal.ID), status)
+	if status == core.DonationGoalLocked {
+		d.unlockNextGoal(ctx)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "goal": d.adminGoalView(ctx, goal, d.goalStatus(ctx, goal))})
+}
+
+// HandleAdminUpdate edits a campaign that has not ended yet. Omitted fields are left unchanged.
+func (d *Donations) HandleAdminUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID          int     `json:"id"`
+		Name        *string `json:"name"`
+		Target      *int64  `json:"target"`
+		Description *string `json:"description"`
+		ImageURL    *string `json:"image_url"`
+		StartsAt    *int64  `json:"starts_at"`
+		EndsAt      *int64  `json:"ends_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	goal := d.loadGoal(ctx, req.ID)
+	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
+	status := d.goalStatus(ctx, *goal)
+	if status != core.DonationGoalLocked && status != core.DonationGoalScheduled && status != core.DonationGoalActive {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "goal has ended", "status": status})
+		return
+	}
+	if req.StartsAt != nil && status != core.DonationGoalScheduled {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "only scheduled goals can be rescheduled"})
+		return
+	}
+	if req.Name != nil { goal.Name = strings.Join(strings.Fields(*req.Name), " ") }
+	if req.Target != nil { goal.Target = *req.Target }
+	if req.Description != nil { goal.Description = strings.TrimSpace(*req.Description) }
+	if req.ImageURL != nil { goal.ImageURL = strings.TrimSpace(*req.ImageURL) }
+	if req.StartsAt != nil { goal.StartsAt = *req.StartsAt }
+	if req.EndsAt != nil { goal.EndsAt = *req.EndsAt }
+	now := time.Now().Unix()
+	if msg := validateGoal(*goal, now); msg != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": msg})
+		return
+	}
+	// The target cannot drop to what has already been raised; that would complete the goal behind donors' backs
+	total, _ := d.RDB.Get(ctx, "donation_goal_total:"+strconv.Itoa(goal.ID)).Int64()
+	if goal.Target <= total {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "target must exceed the amount already donated", "total_donated": total})
+		return
+	}
+	if err := d.saveGoal(ctx, *goal); err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	// Bring a goal rescheduled into the past live right away
+	d.SweepGoals()
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "goal": d.adminGoalView(ctx, *goal, d.goalStatus(ctx, *goal))})
+}
+
+// HandleAdminClose ends a campaign early without paying completion rewards
+func (d *Donations) HandleAdminClose(w http.ResponseWriter, r *http.Request) {
+	var req struct { ID int `json:"id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	goal := d.loadGoal(ctx, req.ID)
+	if goal == nil { http.Error(w, "not found", http.StatusNotFound); return }
+	if !d.transitionGoal(ctx, goal.ID, core.DonationGoalClosed, time.Now().Unix(), core.DonationGoalLocked, core.DonationGoalScheduled, core.DonationGoalActive) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "goal has already ended", "status": d.goalStatus(ctx, *goal)})
+		return
+	}
+	d.unlockNextGoal(ctx)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "goal": d.adminGoalView(ctx, *goal, d.goalStatus(ctx, *goal))})
+}
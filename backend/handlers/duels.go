@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Duels struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewDuels(rdb *redis.Client, auth *Auth) *Duels { return &Duels{RDB: rdb, Auth: auth} }
+
+// challengeDuelScript escrows the challenger's stake and records a pending duel.
+// KEYS: challenger, opponent, leaderboard, duel_next_id, duel_pending, duel_outgoing:<challenger>, duel_incoming:<opponent>
+// ARGV: stake, now, expires at ms, max pending
+// Returns {duelID, newScore}, or {-1,0} unknown opponent, {-2,0} too many pending, {-3,score} insufficient score.
+var challengeDuelScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then return {-1, 0} end
+if redis.call('SCARD', KEYS[6]) >= tonumber(ARGV[4]) then return {-2, 0} end
+local stake = tonumber(ARGV[1])
+local score = tonumber(redis.call('GET', KEYS[1]) or '0')
+if score < stake then return {-3, score} end
+local newScore = redis.call('DECRBY', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[3], newScore, KEYS[1])
+local id = redis.call('INCR', KEYS[4])
+redis.call('HSET', 'duel:' .. id, 'challenger', KEYS[1], 'opponent', KEYS[2], 'stake', ARGV[1],
+	'status', 'pending', 'created_at', ARGV[2], 'expires_at_ms', ARGV[3])
+redis.call('ZADD', KEYS[5], ARGV[3], id)
+redis.call('SADD', KEYS[6], id)
+redis.call('SADD', KEYS[7], id)
+return {id, newScore}
+`)
+
+// acceptDuelScript escrows the opponent's stake and schedules the click window.
+// KEYS: duel:<id>, opponent, leaderboard, duel_pending, duel_active
+// ARGV: duel ID, now ms, countdown ms, duration ms
+// Returns {1, newScore, startsAtMs, endsAtMs}, or {-1} not pending, {-2} not the opponent, {-3} expired, {-4,score} insufficient score.
+var acceptDuelScript = redis.NewScript(`
+local d = redis.call('HMGET', KEYS[1], 'status', 'challenger', 'opponent', 'stake', 'expires_at_ms')
+if d[1] ~= 'pending' then return {-1, 0, 0, 0} end
+if d[3] ~= KEYS[2] then return {-2, 0, 0, 0} end
+local now = tonumber(ARGV[2])
+if tonumber(d[5]) <= now then return {-3, 0, 0, 0} end
+local stake = tonumber(d[4])
+local score = tonumber(redis.call('GET', KEYS[2]) or '0')
+if score < stake then return {-4, score, 0, 0} end
+local newScore = redis.call('DECRBY', KEYS[2], d[4])
+redis.call('ZADD', KEYS[3], newScore, KEYS[2])
+local startsAt = now + tonumber(ARGV[3])
+local endsAt = startsAt + tonumber(ARGV[4])
+redis.call('HSET', KEYS[1], 'status', 'active', 'starts_at_ms', string.format('%d', startsAt), 'ends_at_ms', string.format('%d', endsAt),
+	'challenger_clicks', 0, 'opponent_clicks', 0)
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('ZADD', KEYS[5], string.format('%d', endsAt), ARGV[1])
+redis.call('SREM', 'duel_outgoing:' .. d[2], ARGV[1])
+redis.call('SREM', 'duel_incoming:' .. d[3], ARGV[1])
+redis.call('SADD', 'duel_live:' .. d[2], ARGV[1])
+redis.call('SADD', 'duel_live:' .. d[3], ARGV[1])
+return {1, newScore, startsAt, endsAt}
+`)
+
+// closePendingDuelScript declines, cancels or expires a pending duel and refunds the challenger.
+// With an actor in ARGV[2] only the opponent (declined) or challenger (cancelled) may close it;
+// with an empty actor it is only closed once expired (used by the sweep).
+// KEYS: duel:<id>, leaderboard, duel_pending
+// ARGV: duel ID, actor or '', now ms
+// Returns 1 closed, -1 not pending, -2 not a participant, -3 not yet expired.
+var closePendingDuelScript = redis.NewScript(`
+local d = redis.call('HMGET', KEYS[1], 'status', 'challenger', 'opponent', 'stake', 'expires_at_ms')
+if d[1] ~= 'pending' then return -1 end
+local status
+if ARGV[2] == '' then
+	if tonumber(d[5]) > tonumber(ARGV[3]) then return -3 end
+	status = 'expired'
+elseif ARGV[2] == d[3] then
+	status = 'declined'
+elseif ARGV[2] == d[2] then
+	status = 'cancelled'
+else
+	return -2
+end
+local refunded = redis.call('INCRBY', d[2], d[4])
+redis.call('INCRBY', 'score_credits:' .. d[2], d[4])
+redis.call('ZADD', KEYS[2], refunded, d[2])
+redis.call('HSET', KEYS[1], 'status', status)
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('SREM', 'duel_outgoing:' .. d[2], ARGV[1])
+redis.call('SREM', 'duel_incoming:' .. d[3], ARGV[1])
+return 1
+`)
+
+// duelClickScript counts a tap for a participant inside the click window,
+// capping taps at the plausible maximum for the elapsed time.
+// KEYS: duel:<id>
+// ARGV: user ID, now ms, max clicks per second
+// Returns {challengerClicks, opponentClicks}, or {-1,0} not active, {-2,0} not a participant,
+// {-3,0} window not open, {-4,0} tapping too fast.
+var duelClickScript = redis.NewScript(`
+local d = redis.call('HMGET', KEYS[1], 'status', 'challenger', 'opponent', 'starts_at_ms', 'ends_at_ms', 'challenger_clicks', 'opponent_clicks')
+if d[1] ~= 'active' then return {-1, 0} end
+local field
+if ARGV[1] == d[2] then field = 'challenger_clicks' elseif ARGV[1] == d[3] then field = 'opponent_clicks' else return {-2, 0} end
+local now = tonumber(ARGV[2])
+local startsAt = tonumber(d[4])
+if now < startsAt or now >= tonumber(d[5]) then return {-3, 0} end
+local current = tonumber(redis.call('HGET', KEYS[1], field) or '0')
+local allowed = math.ceil((now - startsAt) / 1000 * tonumber(ARGV[3])) + 1
+if current + 1 > allowed then return {-4, 0} end
+redis.call('HINCRBY', KEYS[1], field, 1)
+return {tonumber(redis.call('HGET', KEYS[1], 'challenger_clicks')), tonumber(redis.call('HGET', KEYS[1], 'opponent_clicks'))}
+`)
+
+// finishDuelScript settles an active duel whose window has closed: the winner
+// takes both stakes, a tie refunds each player, and both Elo ratings move by
+// round(K * (result - expected)) for the challenger and the opposite for the opponent.
+// KEYS: duel:<id>, leaderboard, duel_active, duel_rating
+// ARGV: duel ID, now ms, initial rating, Elo K
+// Returns 1 challenger won, 2 opponent won, 3 tie, or 0 when not ready/already settled.
+var finishDuelScript = redis.NewScript(`
+local d = redis.call('HMGET', KEYS[1], 'status', 'challenger', 'opponent', 'stake', 'ends_at_ms', 'challenger_clicks', 'opponent_clicks')
+if d[1] ~= 'active' then return 0 end
+if tonumber(d[5]) > tonumber(ARGV[2]) then return 0 end
+local cc, oc = tonumber(d[6] or '0'), tonumber(d[7] or '0')
+local result, winner = 3, ''
+if cc > oc then result, winner = 1, d[2] elseif oc > cc then result, winner = 2, d[3] end
+if winner == '' then
+	local s1 = redis.call('INCRBY', d[2], d[4])
+	local s2 = redis.call('INCRBY', d[3], d[4])
+	redis.call('INCRBY', 'score_credits:' .. d[2], d[4])
+	redis.call('INCRBY', 'score_credits:' .. d[3], d[4])
+	redis.call('ZADD', KEYS[2], s1, d[2], s2, d[3])
+else
+	local s = redis.call('INCRBY', winner, string.format('%d', tonumber(d[4]) * 2))
+	redis.call('INCRBY', 'score_credits:' .. winner, string.format('%d', tonumber(d[4]) * 2))
+	redis.call('ZADD', KEYS[2], s, winner)
+end
+local ra = tonumber(redis.call('ZSCORE', KEYS[4], d[2]) or ARGV[3])
+local rb = tonumber(redis.call('ZSCORE', KEYS[4], d[3]) or ARGV[3])
+local scoreA = 0.5
+if result == 1 then scoreA = 1 elseif result == 2 then scoreA = 0 end
+local x = tonumber(ARGV[4]) * (scoreA - 1 / (1 + 10 ^ ((rb - ra) / 400)))
+local delta = math.floor(math.abs(x) + 0.5)
+if x < 0 then delta = -delta end
+redis.call('ZADD', KEYS[4], string.format('%d', ra + delta), d[2], string.format('%d', rb - delta), d[3])
+redis.call('HSET', KEYS[1], 'status', 'finished', 'winner', winner, 'rating_delta', string.format('%d', delta))
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('SREM', 'duel_live:' .. d[2], ARGV[1])
+redis.call('SREM', 'duel_live:' .. d[3], ARGV[1])
+return result
+`)
+
+// duelRating returns the user's Elo rating, defaulting for players without duels
+func (dl *Duels) duelRating(ctx context.Context, userID string) int {
+	rating, err := dl.RDB.ZScore(ctx, "duel_rating", userID).Result()
+	if err != nil {
+		return core.DuelInitialRating
+	}
+	return int(rating)
+}
+
+// finish settles a duel, updating ratings in the same step, and the first
+// time only records it in both players' history
+func (dl *Duels) finish(ctx context.Context, id string) {
+	nowMs := time.Now().UnixMilli()
+	keys := []string{"duel:" + id, "leaderboard", "duel_active", "duel_rating"}
+	result, err := finishDuelScript.Run(ctx, dl.RDB, keys, id, nowMs, core.DuelInitialRating, core.DuelEloK).Int()
+	if err != nil || result == 0 {
+		return
+	}
+	parts, err := dl.RDB.HMGet(ctx, "duel:"+id, "challenger", "opponent").Result()
+	if err != nil {
+		return
+	}
+	for _, part := range parts {
+		uid, _ := part.(string)
+		dl.RDB.LPush(ctx, "duel_history:"+uid, id)
+		dl.RDB.LTrim(ctx, "duel_history:"+uid, 0, core.DuelHistorySize-1)
+	}
+}
+
+// Sweep settles finished click windows and expires unanswered challenges
+func (dl *Duels) Sweep() {
+	ctx := context.Background()
+	nowMs := time.Now().UnixMilli()
+	max := strconv.FormatInt(nowMs, 10)
+	ended, err := dl.RDB.ZRangeByScore(ctx, "duel_active", &redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err == nil {
+		for _, id := range ended {
+			dl.finish(ctx, id)
+		}
+	}
+	expired, err := dl.RDB.ZRangeByScore(ctx, "duel_pending", &redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err == nil {
+		for _, id := range expired {
+			closePendingDuelScript.Run(ctx, dl.RDB, []string{"duel:" + id, "leaderboard", "duel_pending"}, id, "", nowMs)
+		}
+	}
+}
+
+// loadDuel reads a duel as seen by currentUserID, returning nil when unknown
+func (dl *Duels) loadDuel(ctx context.Context, id string, currentUserID string) *core.Duel {
+	data, err := dl.RDB.HGetAll(ctx, "duel:"+id).Result()
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	d := &core.Duel{
+		ChallengerID: data["challenger"],
+		OpponentID:   data["opponent"],
+		Status:       data["status"],
+		WinnerID:     data["winner"],
+		IsChallenger: data["challenger"] == currentUserID,
+	}
+	d.ID, _ = strconv.ParseInt(id, 10, 64)
+	d.Stake, _ = strconv.ParseInt(data["stake"], 10, 64)
+	d.CreatedAt, _ = strconv.ParseInt(data["created_at"], 10, 64)
+	d.ExpiresAtMs, _ = strconv.ParseInt(data["expires_at_ms"], 10, 64)
+	d.StartsAtMs, _ = strconv.ParseInt(data["starts_at_ms"], 10, 64)
+	d.EndsAtMs, _ = strconv.ParseInt(data["ends_at_ms"], 10, 64)
+	d.ChallengerClicks, _ = strconv.ParseInt(data["challenger_clicks"], 10, 64)
+	d.OpponentClicks, _ = strconv.ParseInt(data["opponent_clicks"], 10, 64)
+	d.RatingDelta, _ = strconv.Atoi(data["rating_delta"])
+	// Rating delta is stored from the challenger's perspective
+	if !d.IsChallenger {
+		d.RatingDelta = -d.RatingDelta
+	}
+	return d
+}
+
+// loadDuels reads several duels, skipping unknown IDs
+func (dl *Duels) loadDuels(ctx context.Context, ids []string, currentUserID string) []*core.Duel {
+	out := make([]*core.Duel, 0, len(ids))
+	for _, id := range ids {
+		if d := dl.loadDuel(ctx, id, currentUserID); d != nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// HandleChallenge escrows the caller's stake and challenges another player
+func (dl *Duels) HandleChallenge(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { OpponentID string `json:"opponent_id"`; Stake int64 `json:"stake"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OpponentID == "" || req.Stake < 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if _, err := strconv.ParseInt(req.OpponentID, 10, 64); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	if req.OpponentID == userID {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "cannot duel yourself"})
+		return
+	}
+	now := time.Now()
+	expiresAtMs := now.Add(core.DuelChallengeTTL).UnixMilli()
+	keys := []string{userID, req.OpponentID, "leaderboard", "duel_next_id", "duel_pending", "duel_outgoing:" + userID, "duel_incoming:" + req.OpponentID}
+	res, err := challengeDuelScript.Run(ctx, dl.RDB, keys, req.Stake, now.Unix(), expiresAtMs, core.DuelMaxPending).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		http.Error(w, "opponent not found", http.StatusNotFound)
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "too many pending challenges"})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1]})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"score": res[1],
+		"duel": dl.loadDuel(ctx, strconv.FormatInt(res[0], 10), userID),
+	})
+}
+
+// HandleAccept escrows the opponent's stake and starts the countdown
+func (dl *Duels) HandleAccept(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { DuelID int64 `json:"duel_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DuelID <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	id := strconv.FormatInt(req.DuelID, 10)
+	keys := []string{"duel:" + id, userID, "leaderboard", "duel_pending", "duel_active"}
+	res, err := acceptDuelScript.Run(ctx, dl.RDB, keys, id, time.Now().UnixMilli(), core.DuelCountdown.Milliseconds(), core.DuelDuration.Milliseconds()).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1, -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "challenge not found"})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "challenge expired"})
+		return
+	case -4:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1]})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"score": res[1],
+		"duel": dl.loadDuel(ctx, id, userID),
+	})
+}
+
+// HandleDecline lets the opponent decline or the challenger cancel a pending duel
+func (dl *Duels) HandleDecline(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { DuelID int64 `json:"duel_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DuelID <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	id := strconv.FormatInt(req.DuelID, 10)
+	res, err := closePendingDuelScript.Run(ctx, dl.RDB, []string{"duel:" + id, "leaderboard", "duel_pending"}, id, session.UserID, time.Now().UnixMilli()).Int()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if res != 1 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "challenge not found"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "duel": dl.loadDuel(ctx, id, session.UserID)})
+}
+
+// HandleClick counts a duel tap; these never touch the regular score or click counters
+func (dl *Duels) HandleClick(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { DuelID int64 `json:"duel_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DuelID <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	id := strconv.FormatInt(req.DuelID, 10)
+	res, err := duelClickScript.Run(ctx, dl.RDB, []string{"duel:" + id}, session.UserID, time.Now().UnixMilli(), core.DuelMaxClicksPerSecond).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1, -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "duel not active"})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "click window closed"})
+		return
+	case -4:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "clicking too fast"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"challenger_clicks": res[0],
+		"opponent_clicks": res[1],
+	})
+}
+
+// HandleGetDuel returns a single duel, settling it first if its window has closed
+func (dl *Duels) HandleGetDuel(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	id := r.URL.Query().Get("id")
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	dl.finish(ctx, id)
+	d := dl.loadDuel(ctx, id, session.UserID)
+	if d == nil || (d.ChallengerID != session.UserID && d.OpponentID != session.UserID) { http.Error(w, "not found", http.StatusNotFound); return }
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// HandleListDuels returns the caller's rating, open challenges and recent history
+func (dl *Duels) HandleListDuels(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	incoming, _ := dl.RDB.SMembers(ctx, "duel_incoming:"+userID).Result()
+	outgoing, _ := dl.RDB.SMembers(ctx, "duel_outgoing:"+userID).Result()
+	live, _ := dl.RDB.SMembers(ctx, "duel_live:"+userID).Result()
+	history, _ := dl.RDB.LRange(ctx, "duel_history:"+userID, 0, core.DuelHistorySize-1).Result()
+	wins, losses, ties := 0, 0, 0
+	historyDuels := dl.loadDuels(ctx, history, userID)
+	for _, d := range historyDuels {
+		switch d.WinnerID {
+		case userID:
+			wins++
+		case "":
+			ties++
+		default:
+			losses++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rating": dl.duelRating(ctx, userID),
+		"incoming": dl.loadDuels(ctx, incoming, userID),
+		"outgoing": dl.loadDuels(ctx, outgoing, userID),
+		"active": dl.loadDuels(ctx, live, userID),
+		"history": historyDuels,
+		"wins": wins,
+		"losses": losses,
+		"ties": ties,
+	})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Friends struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewFriends(rdb *redis.Client, auth *Auth) *Friends { return &Friends{RDB: rdb, Auth: auth} }
+
+// friendIDs returns the user's friends: players they added explicitly plus
+// everyone linked to them by a referral, in either direction
+func (f *Friends) friendIDs(ctx context.Context, userID string) (added []string, all []string) {
+	added, _ = f.RDB.SMembers(ctx, "friends:"+userID).Result()
+	invitees, _ := f.RDB.ZRange(ctx, "referrals:"+userID, 0, -1).Result()
+	seen := make(map[string]bool)
+	for _, list := range [][]string{added, invitees} {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				all = append(all, id)
+			}
+		}
+	}
+	if referrer, err := f.RDB.Get(ctx, "referrer:"+userID).Result(); err == nil && !seen[referrer] {
+		all = append(all, referrer)
+	}
+	return added, all
+}
+
+// HandleList returns the caller's friends and how each one is linked to them
+func (f *Friends) HandleList(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	added, all := f.friendIDs(ctx, session.UserID)
+	explicit := make(map[string]bool, len(added))
+	for _, id := range added {
+		explicit[id] = true
+	}
+	type Friend struct {
+		UserID   string `json:"user_id"`
+		FriendID string `json:"friend_id,omitempty"`
+		Referral bool   `json:"referral"`
+	}
+	out := make([]Friend, 0, len(all))
+	for _, id := range all {
+		friend := Friend{UserID: core.MaskTelegramID(id), Referral: !explicit[id]}
+		// Players added by ID are shown unmasked so they can be removed again
+		if explicit[id] {
+			friend.FriendID = id
+		}
+		out = append(out, friend)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"friends": out, "max": core.FriendsMax})
+}
+
+// HandleAdd adds a player to the caller's friends by Telegram ID
+func (f *Friends) HandleAdd(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { UserID string `json:"user_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if _, err := strconv.ParseUint(req.UserID, 10, 64); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	if req.UserID == userID {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "cannot add yourself"})
+		return
+	}
+	exists, err := f.RDB.Exists(ctx, req.UserID).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if exists == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "player not found"})
+		return
+	}
+	count, _ := f.RDB.SCard(ctx, "friends:"+userID).Result()
+	if count >= core.FriendsMax {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "friend list is full"})
+		return
+	}
+	added, err := f.RDB.SAdd(ctx, "friends:"+userID, req.UserID).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "added": added == 1})
+}
+
+// HandleRemove removes a player the caller added. Referral links cannot be removed.
+func (f *Friends) HandleRemove(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { UserID string `json:"user_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	removed, err := f.RDB.SRem(ctx, "friends:"+session.UserID, req.UserID).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if removed == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not a friend"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// HandleLeaderboard ranks the caller among their friends by score,
+// production rate or clicks (?metric=score|production_rate|clicks)
+func (f *Friends) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "score"
+	}
+	var key string
+	switch metric {
+	case "score":
+		key = "leaderboard"
+	case "production_rate":
+		key = "production_rate"
+	case "clicks":
+		key = "clicks_leaderboard"
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	currentUserID := session.UserID
+	_, friends := f.friendIDs(ctx, currentUserID)
+	members := []string{currentUserID}
+	// Friends excluded from leaderboards are hidden here too; viewers always see themselves
+	var excluded []bool
+	if len(friends) > 0 {
+		ids := make([]interface{}, len(friends))
+		for i, id := range friends {
+			ids[i] = id
+		}
+		excluded, _ = f.RDB.SMIsMember(ctx, "leaderboard_excluded", ids...).Result()
+	}
+	for i, id := range friends {
+		if i < len(excluded) && excluded[i] {
+			continue
+		}
+		members = append(members, id)
+	}
+	scores, err := f.RDB.ZMScore(ctx, key, members...).Result()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch friends leaderboard"})
+		return
+	}
+	value := scoreValue
+	if metric == "production_rate" {
+		buff := communityBuffPercent(ctx, f.RDB)
+		value = func(rate float64) int64 { return int64(withCommunityBuffs(int(rate), buff)) }
+	}
+	ranked := make([]redis.Z, len(members))
+	for i, id := range members {
+		ranked[i] = redis.Z{Score: scores[i], Member: id}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	selfRank := int64(-1)
+	var selfValue float64
+	for i, z := range ranked {
+		if z.Member.(string) == currentUserID {
+			selfRank, selfValue = int64(i), z.Score
+			break
+		}
+	}
+	names := displayNames(ctx, f.RDB, members)
+	out := rankedPage(ranked, 0, int64(len(ranked)), metric, value, names, currentUserID, selfRank, selfValue)
+	out["metric"] = metric
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Gifts struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewGifts(rdb *redis.Client, auth *Auth) *Gifts { return &Gifts{RDB: rdb, Auth: auth} }
+
+// giftScript moves score between two players, enforcing daily caps, updating
+// both leaderboard entries and appending to the transfer log in one step.
+// KEYS: sender, recipient, leaderboard, sender daily sent, recipient daily received, gift_next_id, gift_log
+// ARGV: amount, fee, send cap, receive cap, cap TTL seconds, now
+// Returns {transferID, newScore}, or {-1,0} unknown recipient, {-2,score} insufficient score,
+// {-3,sent} send cap reached, {-4,received} recipient receive cap reached.
+var giftScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then return {-1, 0} end
+local amount = tonumber(ARGV[1])
+local score = tonumber(redis.call('GET', KEYS[1]) or '0')
+if score < amount then return {-2, score} end
+local sent = tonumber(redis.call('GET', KEYS[4]) or '0')
+if sent + amount > tonumber(ARGV[3]) then return {-3, sent} end
+local net = amount - tonumber(ARGV[2])
+local received = tonumber(redis.call('GET', KEYS[5]) or '0')
+if received + net > tonumber(ARGV[4]) then return {-4, received} end
+local newScore = redis.call('DECRBY', KEYS[1], ARGV[1])
+local recipientScore = redis.call('INCRBY', KEYS[2], string.format('%d', net))
+redis.call('INCRBY', 'score_credits:' .. KEYS[2], string.format('%d', net))
+redis.call('ZADD', KEYS[3], newScore, KEYS[1], recipientScore, KEYS[2])
+redis.call('INCRBY', KEYS[4], ARGV[1])
+redis.call('EXPIRE', KEYS[4], ARGV[5])
+redis.call('INCRBY', KEYS[5], string.format('%d', net))
+redis.call('EXPIRE', KEYS[5], ARGV[5])
+local id = redis.call('INCR', KEYS[6])
+redis.call('HSET', 'gift:' .. id, 'from', KEYS[1], 'to', KEYS[2], 'amount', ARGV[1], 'fee', ARGV[2], 'net', string.format('%d', net), 'created_at', ARGV[6])
+redis.call('LPUSH', KEYS[7], id)
+redis.call('LPUSH', 'gift_log:' .. KEYS[1], id)
+redis.call('LPUSH', 'gift_log:' .. KEYS[2], id)
+return {id, newScore}
+`)
+
+// accountAge returns how long ago the user first started playing. Users with no
+// creation record are treated as brand new.
+func accountAge(ctx context.Context, rdb *redis.Client, userID string) time.Duration {
+	created, err := rdb.Get(ctx, "user_created:"+userID).Int64()
+	if err != nil {
+		return 0
+	}
+	return time.Since(time.Unix(created, 0))
+}
+
+// loadGift reads one transfer log entry
+func (gf *Gifts) loadGift(ctx context.Context, id int64) (*core.GiftTransfer, error) {
+	data, err := gf.RDB.HGetAll(ctx, "gift:"+strconv.FormatInt(id, 10)).Result()
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	t := &core.GiftTransfer{ID: id, From: data["from"], To: data["to"]}
+	t.Amount, _ = strconv.ParseInt(data["amount"], 10, 64)
+	t.Fee, _ = strconv.ParseInt(data["fee"], 10, 64)
+	t.Net, _ = strconv.ParseInt(data["net"], 10, 64)
+	t.CreatedAt, _ = strconv.ParseInt(data["created_at"], 10, 64)
+	return t, nil
+}
+
+// HandleSend transfers part of the caller's score to another player
+func (gf *Gifts) HandleSend(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { ToUserID string `json:"to_user_id"`; Amount int64 `json:"amount"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ToUserID == "" || req.Amount <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if _, err := strconv.ParseInt(req.ToUserID, 10, 64); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	if req.ToUserID == userID {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "cannot gift yourself"})
+		return
+	}
+	if req.Amount < core.GiftMinAmount {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "amount below minimum", "min_amount": core.GiftMinAmount})
+		return
+	}
+	if age := accountAge(ctx, gf.RDB, userID); age < core.GiftMinAccountAge {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "account too new to send gifts",
+			"available_in": int64((core.GiftMinAccountAge - age).Seconds()),
+		})
+		return
+	}
+	now := time.Now()
+	day := core.DayKey(now)
+	fee := core.CalculateGiftFee(req.Amount)
+	keys := []string{
+		userID,
+		req.ToUserID,
+		"leaderboard",
+		"gift_sent:" + userID + ":" + day,
+		"gift_received:" + req.ToUserID + ":" + day,
+		"gift_next_id",
+		"gift_log",
+	}
+	capTTL := int64((48 * time.Hour).Seconds())
+	res, err := giftScript.Run(ctx, gf.RDB, keys, req.Amount, fee, core.GiftDailySendCap, core.GiftDailyReceiveCap, capTTL, now.Unix()).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		http.Error(w, "recipient not found", http.StatusNotFound)
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1]})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "daily send limit reached", "remaining": core.GiftDailySendCap - res[1]})
+		return
+	case -4:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "recipient daily receive limit reached"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"score": res[1],
+		"transfer": core.GiftTransfer{ID: res[0], From: userID, To: req.ToUserID, Amount: req.Amount, Fee: fee, Net: req.Amount - fee, CreatedAt: now.Unix()},
+	})
+}
+
+// HandleHistory returns the caller's transfer log and today's limits
+func (gf *Gifts) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 { offset = 0 }
+	ids, err := gf.RDB.LRange(ctx, "gift_log:"+userID, int64(offset), int64(offset+core.GiftHistoryPageSize-1)).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	type Entry struct {
+		core.GiftTransfer
+		Direction string `json:"direction"`
+	}
+	entries := make([]Entry, 0, len(ids))
+	for _, idStr := range ids {
+		id, _ := strconv.ParseInt(idStr, 10, 64)
+		t, err := gf.loadGift(ctx, id)
+		if err != nil || t == nil {
+			continue
+		}
+		e := Entry{GiftTransfer: *t, Direction: "received"}
+		if t.From == userID {
+			e.Direction = "sent"
+		}
+		entries = append(entries, e)
+	}
+	total, _ := gf.RDB.LLen(ctx, "gift_log:"+userID).Result()
+	day := core.DayKey(time.Now())
+	sent, _ := gf.RDB.Get(ctx, "gift_sent:"+userID+":"+day).Int64()
+	received, _ := gf.RDB.Get(ctx, "gift_received:"+userID+":"+day).Int64()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"transfers": entries,
+		"total": total,
+		"offset": offset,
+		"limits": map[string]interface{}{
+			"sent_today": sent,
+			"received_today": received,
+			"send_cap": core.GiftDailySendCap,
+			"receive_cap": core.GiftDailyReceiveCap,
+			"fee_percent": core.GiftFeePercent,
+			"min_amount": core.GiftMinAmount,
+		},
+	})
+}
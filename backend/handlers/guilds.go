@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Guilds struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewGuilds(rdb *redis.Client, auth *Auth) *Guilds { return &Guilds{RDB: rdb, Auth: auth} }
+
+// createGuildScript reserves the guild name, charges the creation cost and
+// registers the creator as leader of the guild ID allocated by the caller.
+// KEYS: user_guild:<uid>, guild_names, user, leaderboard, guilds, guild:<id>, guild_members:<id>
+// ARGV: name key, name, cost, now, guild ID
+// Returns {guildID, newScore}, or {-1,0} already in a guild, {-2,0} name taken, {-3,score} insufficient score.
+var createGuildScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return {-1, 0} end
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then return {-2, 0} end
+local score = tonumber(redis.call('GET', KEYS[3]) or '0')
+if score < tonumber(ARGV[3]) then return {-3, score} end
+local newScore = redis.call('DECRBY', KEYS[3], ARGV[3])
+redis.call('ZADD', KEYS[4], newScore, KEYS[3])
+redis.call('HSET', KEYS[6], 'name', ARGV[2], 'name_key', ARGV[1], 'leader', KEYS[3], 'treasury', 0, 'created_at', ARGV[4])
+redis.call('HSET', KEYS[7], KEYS[3], 'leader')
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[5])
+redis.call('SADD', KEYS[5], ARGV[5])
+redis.call('SET', KEYS[1], ARGV[5])
+return {tonumber(ARGV[5]), newScore}
+`)
+
+// joinGuildScript adds a member if the user is guildless and the guild has room.
+// Returns 1 on success, -1 already in a guild, -2 unknown guild, -3 guild full.
+var joinGuildScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return -1 end
+if redis.call('EXISTS', KEYS[2]) == 0 then return -2 end
+if redis.call('HLEN', KEYS[3]) >= tonumber(ARGV[2]) then return -3 end
+redis.call('HSET', KEYS[3], ARGV[1], 'member')
+redis.call('SET', KEYS[1], ARGV[3])
+return 1
+`)
+
+// The scripts below act on the guild the caller's user_guild key pointed to
+// when its keys were resolved (ARGV[1]), and report "not in a guild" when the
+// user has left or switched guilds since.
+
+// leaveGuildScript removes the user from their guild, handing leadership to an
+// officer (or any member) and disbanding the guild when the last member leaves.
+// KEYS: user_guild:<uid>, guilds, guild_names, guild_leaderboard, guild:<id>, guild_members:<id>, guild_contributions:<id>
+// ARGV: guild ID, user ID
+// Returns {status, guildID}: -1 not in a guild, 0 disbanded, 1 left.
+var leaveGuildScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return {-1, 0} end
+local id = ARGV[1]
+local role = redis.call('HGET', KEYS[6], ARGV[2])
+redis.call('HDEL', KEYS[6], ARGV[2])
+redis.call('DEL', KEYS[1])
+if redis.call('HLEN', KEYS[6]) == 0 then
+	local nameKey = redis.call('HGET', KEYS[5], 'name_key')
+	if nameKey then redis.call('HDEL', KEYS[3], nameKey) end
+	redis.call('DEL', KEYS[5], KEYS[6], KEYS[7])
+	redis.call('SREM', KEYS[2], id)
+	redis.call('ZREM', KEYS[4], id)
+	return {0, tonumber(id)}
+end
+if role == 'leader' then
+	local members = redis.call('HGETALL', KEYS[6])
+	local successor = members[1]
+	for i = 1, #members, 2 do
+		if members[i + 1] == 'officer' then
+			successor = members[i]
+			break
+		end
+	end
+	redis.call('HSET', KEYS[6], successor, 'leader')
+	redis.call('HSET', KEYS[5], 'leader', successor)
+end
+return {1, tonumber(id)}
+`)
+
+// contributeGuildScript moves score from a member into their guild treasury.
+// KEYS: user, leaderboard, user_guild:<uid>, guild:<id>, guild_contributions:<id>
+// ARGV: guild ID, amount
+// Returns {guildID, newScore, treasury}, or {-1,0,0} not in a guild, {-2,score,0} insufficient score.
+var contributeGuildScript = redis.NewScript(`
+if redis.call('GET', KEYS[3]) ~= ARGV[1] then return {-1, 0, 0} end
+local score = tonumber(redis.call('GET', KEYS[1]) or '0')
+if score < tonumber(ARGV[2]) then return {-2, score, 0} end
+local newScore = redis.call('DECRBY', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], newScore, KEYS[1])
+local treasury = redis.call('HINCRBY', KEYS[4], 'treasury', ARGV[2])
+redis.call('ZINCRBY', KEYS[5], ARGV[2], KEYS[1])
+return {tonumber(ARGV[1]), newScore, treasury}
+`)
+
+// kickGuildScript removes ARGV[3] from the actor's (ARGV[2]) guild when the
+// actor is at least an officer and outranks them. Ranks mirror core.GuildRoleRank.
+// KEYS: user_guild:<actor>, user_guild:<target>, guild_members:<id>
+// ARGV: guild ID, actor, target
+// Returns {status, guildID}: 1 kicked, -1 not in a guild, -2 target not a member, -3 insufficient role.
+var kickGuildScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return {-1, 0} end
+local id = tonumber(ARGV[1])
+local rank = {member = 1, officer = 2, leader = 3}
+local actor = rank[redis.call('HGET', KEYS[3], ARGV[2]) or ''] or 0
+local target = redis.call('HGET', KEYS[3], ARGV[3])
+if not target then return {-2, id} end
+if actor < rank.officer or actor <= (rank[target] or 0) then return {-3, id} end
+redis.call('HDEL', KEYS[3], ARGV[3])
+redis.call('DEL', KEYS[2])
+return {1, id}
+`)
+
+// setGuildRoleScript gives ARGV[3] the role ARGV[4] when the actor (ARGV[2])
+// leads their guild. Handing over leadership demotes the actor to officer.
+// KEYS: user_guild:<actor>, guild:<id>, guild_members:<id>
+// ARGV: guild ID, actor, target, role
+// Returns {status, guildID}: 1 changed, -1 not in a guild, -2 actor not the leader, -3 target not a member.
+var setGuildRoleScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return {-1, 0} end
+local id = tonumber(ARGV[1])
+if redis.call('HGET', KEYS[3], ARGV[2]) ~= 'leader' then return {-2, id} end
+if ARGV[3] == ARGV[2] or redis.call('HEXISTS', KEYS[3], ARGV[3]) == 0 then return {-3, id} end
+redis.call('HSET', KEYS[3], ARGV[3], ARGV[4])
+if ARGV[4] == 'leader' then
+	redis.call('HSET', KEYS[3], ARGV[2], 'officer')
+	redis.call('HSET', KEYS[2], 'leader', ARGV[3])
+end
+return {1, id}
+`)
+
+// guildBonusPercent returns the production bonus of the user's guild, or 0 when guildless
+func guildBonusPercent(ctx context.Context, rdb *redis.Client, userID string) int {
+	id, err := rdb.Get(ctx, "user_guild:"+userID).Result()
+	if err != nil {
+		return 0
+	}
+	treasury, err := rdb.HGet(ctx, "guild:"+id, "treasury").Int64()
+	if err != nil {
+		return 0
+	}
+	return core.GuildProductionBonusPercent(treasury)
+}
+
+// loadGuild reads a guild's metadata, returning nil when it does not exist
+func (g *Guilds) loadGuild(ctx context.Context, id int64) (*core.Guild, error) {
+	idStr := strconv.FormatInt(id, 10)
+	data, err := g.RDB.HGetAll(ctx, "guild:"+idStr).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	members, _ := g.RDB.HLen(ctx, "guild_members:"+idStr).Result()
+	treasury, _ := strconv.ParseInt(data["treasury"], 10, 64)
+	createdAt, _ := strconv.ParseInt(data["created_at"], 10, 64)
+	return &core.Guild{
+		ID:           id,
+		Name:         data["name"],
+		LeaderID:     data["leader"],
+		Treasury:     treasury,
+		Members:      int(members),
+		BonusPercent: core.GuildProductionBonusPercent(treasury),
+		CreatedAt:    createdAt,
+	}, nil
+}
+
+// userGuildID returns the guild the user belongs to, or 0 when guildless
+func (g *Guilds) userGuildID(ctx context.Context, userID string) int64 {
+	id, err := g.RDB.Get(ctx, "user_guild:"+userID).Int64()
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// refreshGuildScore recomputes one guild's aggregate score from its members' scores
+func (g *Guilds) refreshGuildScore(ctx context.Context, id int64) error {
+	idStr := strconv.FormatInt(id, 10)
+	members, err := g.RDB.HKeys(ctx, "guild_members:"+idStr).Result()
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return g.RDB.ZRem(ctx, "guild_leaderboard", idStr).Err()
+	}
+	scores, err := g.RDB.ZMScore(ctx, "leaderboard", members...).Result()
+	if err != nil {
+		return err
+	}
+	// Players hidden from leaderboards do not count towards their guild
+	ids := make([]interface{}, len(members))
+	for i, uid := range members {
+		ids[i] = uid
+	}
+	excluded, err := g.RDB.SMIsMember(ctx, "leaderboard_excluded", ids...).Result()
+	if err != nil {
+		return err
+	}
+	var total float64
+	for i, s := range scores {
+		if i < len(excluded) && excluded[i] {
+			continue
+		}
+		total += s
+	}
+	return g.RDB.ZAdd(ctx, "guild_leaderboard", redis.Z{Score: total, Member: idStr}).Err()
+}
+
+// RefreshLeaderboard recomputes the aggregate score of every guild
+func (g *Guilds) RefreshLeaderboard() {
+	ctx := context.Background()
+	ids, err := g.RDB.SMembers(ctx, "guilds").Result()
+	if err != nil {
+		return
+	}
+	for _, idStr := range ids {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		g.refreshGuildScore(ctx, id)
+	}
+}
+
+// HandleGetGuild returns a guild with its roster; defaults to the caller's guild
+func (g *Guilds) HandleGetGuild(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	id := g.userGuildID(ctx, userID)
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		parsed, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+		id = parsed
+	}
+	if id == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"guild": nil})
+		return
+	}
+	guild, err := g.loadGuild(ctx, id)
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if guild == nil { http.Error(w, "not found", http.StatusNotFound); return }
+	idStr := strconv.FormatInt(id, 10)
+	roles, _ := g.RDB.HGetAll(ctx, "guild_members:"+idStr).Result()
+	uids := make([]string, 0, len(roles))
+	for uid := range roles {
+		uids = append(uids, uid)
+	}
+	members := make([]core.GuildMember, 0, len(uids))
+	if len(uids) > 0 {
+		scores, _ := g.RDB.ZMScore(ctx, "leaderboard", uids...).Result()
+		contributions, _ := g.RDB.ZMScore(ctx, "guild_contributions:"+idStr, uids...).Result()
+		ids := make([]interface{}, len(uids))
+		for i, uid := range uids {
+			ids[i] = uid
+		}
+		excluded, _ := g.RDB.SMIsMember(ctx, "leaderboard_excluded", ids...).Result()
+		for i, uid := range uids {
+			// Hidden players are left off the roster, except for themselves
+			if i < len(excluded) && excluded[i] && uid != userID {
+				continue
+			}
+			m := core.GuildMember{UserID: uid, Role: roles[uid], IsSelf: uid == userID}
+			if i < len(scores) { m.Score = int64(scores[i]) }
+			if i < len(contributions) { m.Contributed = int64(contributions[i]) }
+			members = append(members, m)
+		}
+	}
+	// Leader first, then officers, then by score
+	sortGuildMembers(members)
+	rank, err := g.RDB.ZRevRank(ctx, "guild_leaderboard", idStr).Result()
+	if err != nil { rank = -1 }
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"guild": guild,
+		"rank": rank + 1,
+		"members": members,
+		"is_member": roles[userID] != "",
+		"role": roles[userID],
+	})
+}
+
+func (g *Guilds) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { Name string `json:"name"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	name := strings.Join(strings.Fields(req.Name), " ")
+	if n := utf8.RuneCountInString(name); n < core.GuildNameMinLength || n > core.GuildNameMaxLength {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "invalid guild name"})
+		return
+	}
+	ctx := context.Background()
+	userID := session.UserID
+	id, err := g.RDB.Incr(ctx, "guild_next_id").Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	idStr := strconv.FormatInt(id, 10)
+	keys := []string{"user_guild:" + userID, "guild_names", userID, "leaderboard", "guilds", "guild:" + idStr, "guild_members:" + idStr}
+	res, err := createGuildScript.Run(ctx, g.RDB, keys, strings.ToLower(name), name, core.GuildCreateCost, time.Now().Unix(), id).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "already in a guild"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "guild name taken"})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1], "cost": core.GuildCreateCost})
+		return
+	}
+	g.refreshGuildScore(ctx, res[0])
+	guild, _ := g.loadGuild(ctx, res[0])
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "score": res[1], "guild": guild})
+}
+
+func (g *Guilds) HandleJoin(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { GuildID int64 `json:"guild_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GuildID <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	idStr := strconv.FormatInt(req.GuildID, 10)
+	keys := []string{"user_guild:" + userID, "guild:" + idStr, "guild_members:" + idStr}
+	res, err := joinGuildScript.Run(ctx, g.RDB, keys, userID, core.GuildMaxMembers, idStr).Int64()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "already in a guild"})
+		return
+	case -2:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "guild is full"})
+		return
+	}
+	g.refreshGuildScore(ctx, req.GuildID)
+	UpdateProductionRate(ctx, g.RDB, userID)
+	guild, _ := g.loadGuild(ctx, req.GuildID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "guild": guild})
+}
+
+func (g *Guilds) HandleLeave(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	id := g.userGuildID(ctx, userID)
+	if id == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	}
+	idStr := strconv.FormatInt(id, 10)
+	keys := []string{"user_guild:" + userID, "guilds", "guild_names", "guild_leaderboard", "guild:" + idStr, "guild_members:" + idStr, "guild_contributions:" + idStr}
+	res, err := leaveGuildScript.Run(ctx, g.RDB, keys, id, userID).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if res[0] == -1 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	}
+	if res[0] == 1 {
+		g.refreshGuildScore(ctx, res[1])
+	}
+	UpdateProductionRate(ctx, g.RDB, userID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "disbanded": res[0] == 0})
+}
+
+func (g *Guilds) HandleKick(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { UserID string `json:"user_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	id := g.userGuildID(ctx, userID)
+	if id == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	}
+	idStr := strconv.FormatInt(id, 10)
+	// Officers may kick members; the leader may kick anyone below them
+	keys := []string{"user_guild:" + userID, "user_guild:" + req.UserID, "guild_members:" + idStr}
+	res, err := kickGuildScript.Run(ctx, g.RDB, keys, id, userID, req.UserID).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "user is not a member"})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient guild role"})
+		return
+	}
+	g.refreshGuildScore(ctx, res[1])
+	UpdateProductionRate(ctx, g.RDB, req.UserID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// HandleSetRole lets the leader promote/demote members or hand over leadership
+func (g *Guilds) HandleSetRole(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { UserID string `json:"user_id"`; Role string `json:"role"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" || core.GuildRoleRank(req.Role) == 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	id := g.userGuildID(ctx, userID)
+	if id == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	}
+	idStr := strconv.FormatInt(id, 10)
+	keys := []string{"user_guild:" + userID, "guild:" + idStr, "guild_members:" + idStr}
+	res, err := setGuildRoleScript.Run(ctx, g.RDB, keys, id, userID, req.UserID, req.Role).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "only the leader can change roles"})
+		return
+	case -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "user is not a member"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// HandleContribute moves score from the caller into their guild treasury
+func (g *Guilds) HandleContribute(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { Amount int64 `json:"amount"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	id := g.userGuildID(ctx, userID)
+	if id == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	}
+	idStr := strconv.FormatInt(id, 10)
+	keys := []string{userID, "leaderboard", "user_guild:" + userID, "guild:" + idStr, "guild_contributions:" + idStr}
+	res, err := contributeGuildScript.Run(ctx, g.RDB, keys, id, req.Amount).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not in a guild"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1]})
+		return
+	}
+	g.refreshGuildScore(ctx, res[0])
+	// Reaching a new bonus tier changes every member's production
+	if core.GuildProductionBonusPercent(res[2]-req.Amount) != core.GuildProductionBonusPercent(res[2]) {
+		members, _ := g.RDB.HKeys(ctx, "guild_members:"+strconv.FormatInt(res[0], 10)).Result()
+		for _, member := range members {
+			UpdateProductionRate(ctx, g.RDB, member)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"score": res[1],
+		"treasury": res[2],
+		"bonus_percent": core.GuildProductionBonusPercent(res[2]),
+	})
+}
+
+func sortGuildMembers(members []core.GuildMember) {
+	sort.Slice(members, func(i, j int) bool {
+		ri, rj := core.GuildRoleRank(members[i].Role), core.GuildRoleRank(members[j].Role)
+		if ri != rj {
+			return ri > rj
+		}
+		return members[i].Score > members[j].Score
+	})
+}
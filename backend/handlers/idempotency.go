@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// idempotentResponse is the first response to a request, replayed for retries
+// that carry the same Idempotency-Key
+type idempotentResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body"`
+	RequestHash string `json:"request_hash"`
+}
+
+// idempotencyPending marks a key whose first request is still being handled
+const idempotencyPending = "pending"
+
+// responseRecorder passes a response through to the client while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+type Idempotency struct {
+	RDB *redis.Client
+}
+
+func NewIdempotency(rdb *redis.Client) *Idempotency { return &Idempotency{RDB: rdb} }
+
+// Middleware honors the Idempotency-Key header on state-changing requests. The
+// first response for a user, route and key is stored for core.IdempotencyTTL
+// and replayed for duplicates; reusing a key with a different body is rejected.
+// Server errors are not stored, so the request can be retried. It must run
+// behind Auth.Middleware.
+func (i *Idempotency) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		session, ok := SessionFromContext(r.Context())
+		if key == "" || !ok || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		if len(key) > core.IdempotencyKeyMaxLength {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		ctx := context.Background()
+		storeKey := "idempotency:" + session.UserID + ":" + r.URL.Path + ":" + key
+		first, err := i.RDB.SetNX(ctx, storeKey, idempotencyPending, core.IdempotencyLockTTL).Result()
+		if err != nil {
+			// Fail open: handle the request as if no key was sent
+			next(w, r)
+			return
+		}
+		if !first {
+			i.replay(ctx, w, storeKey, requestHash)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= http.StatusInternalServerError {
+			i.RDB.Del(ctx, storeKey)
+			return
+		}
+		stored, _ := json.Marshal(idempotentResponse{
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+			RequestHash: requestHash,
+		})
+		i.RDB.Set(ctx, storeKey, stored, core.IdempotencyTTL)
+	}
+}
+
+// replay answers a duplicate request with the stored response
+func (i *Idempotency) replay(ctx context.Context, w http.ResponseWriter, storeKey string, requestHash string) {
+	raw, err := i.RDB.Get(ctx, storeKey).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if raw == idempotencyPending {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "request with this idempotency key is in progress", http.StatusConflict)
+		return
+	}
+	var resp idempotentResponse
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if resp.RequestHash != requestHash {
+		http.Error(w, "idempotency key reused with a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
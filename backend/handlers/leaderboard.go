@@ -4,7 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"sort"
+	"strconv"
+	"time"
 
 	core "neon-clicker/core"
 	"github.com/redis/go-redis/v9"
@@ -18,89 +19,288 @@ type Leaderboard struct {
 
 func NewLeaderboard(rdb *redis.Client, auth *Auth, prod *Producers) *Leaderboard { return &Leaderboard{RDB: rdb, Auth: auth, Prod: prod} }
 
-func (h *Leaderboard) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
-	session, err := h.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
+// leaderboardPage is the requested slice of a leaderboard: either an
+// offset/limit page or a window of players around the caller
+type leaderboardPage struct {
+	Offset int64
+	Limit  int64
+	Around bool
+	Window int64
+}
+
+// parseLeaderboardPage reads ?offset=&limit= or ?around=me&window= from the query
+func parseLeaderboardPage(r *http.Request) leaderboardPage {
+	q := r.URL.Query()
+	p := leaderboardPage{Limit: core.LeaderboardPageSize, Window: core.LeaderboardAroundWindow}
+	if v, err := strconv.ParseInt(q.Get("offset"), 10, 64); err == nil && v > 0 {
+		p.Offset = v
 	}
-	currentUserID := session.UserID
-	ctx := context.Background()
-	results, err := h.RDB.ZRevRangeWithScores(ctx, "leaderboard", 0, 19).Result()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch leaderboard"})
-		return
+	if v, err := strconv.ParseInt(q.Get("limit"), 10, 64); err == nil && v > 0 {
+		p.Limit = min(v, core.LeaderboardMaxPageSize)
+	}
+	p.Around = q.Get("around") == "me"
+	if v, err := strconv.ParseInt(q.Get("window"), 10, 64); err == nil && v > 0 {
+		p.Window = min(v, core.LeaderboardMaxAroundWindow)
 	}
-	var entries []map[string]interface{}
+	return p
+}
+
+// bounds returns the inclusive rank range (0-based) to fetch. An "around me"
+// request for an unranked caller falls back to the first page.
+func (p leaderboardPage) bounds(selfRank int64) (int64, int64) {
+	if p.Around && selfRank >= 0 {
+		start := max(selfRank-p.Window, 0)
+		return start, selfRank + p.Window
+	}
+	return p.Offset, p.Offset + p.Limit - 1
+}
+
+// rankedNames looks up the public display names of a leaderboard page and the caller
+func rankedNames(ctx context.Context, rdb *redis.Client, results []redis.Z, currentUserID string) map[string]string {
+	ids := make([]string, 0, len(results)+1)
 	for _, z := range results {
+		ids = append(ids, z.Member.(string))
+	}
+	return displayNames(ctx, rdb, append(ids, currentUserID))
+}
+
+// rankedPage renders a slice of a leaderboard starting at rank start, together
+// with paging info and the caller's own rank and value (rank is -1 when unranked)
+func rankedPage(results []redis.Z, start int64, total int64, field string, value func(float64) int64, names map[string]string, currentUserID string, selfRank int64, selfValue float64) map[string]interface{} {
+	entries := make([]map[string]interface{}, len(results))
+	for i, z := range results {
 		userID := z.Member.(string)
-		entries = append(entries, map[string]interface{}{
+		entries[i] = map[string]interface{}{
+			"rank": start + int64(i) + 1,
 			"user_id": core.MaskTelegramID(userID),
-			"score": int64(z.Score),
+			"display_name": publicName(names, userID),
+			field: value(z.Score),
 			"is_self": userID == currentUserID,
-		})
+		}
+	}
+	var next interface{}
+	if end := start + int64(len(results)); end < total {
+		next = end
+	}
+	var self interface{}
+	if selfRank >= 0 {
+		self = map[string]interface{}{
+			"rank": selfRank + 1,
+			"user_id": core.MaskTelegramID(currentUserID),
+			"display_name": publicName(names, currentUserID),
+			field: value(selfValue),
+		}
+	}
+	return map[string]interface{}{
+		"entries": entries,
+		"offset": start,
+		"total": total,
+		"next_offset": next,
+		"self": self,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(entries)
 }
 
-func (h *Leaderboard) HandlePerSecond(w http.ResponseWriter, r *http.Request) {
-	session, err := h.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
+// scoreValue reports a leaderboard score as is
+func scoreValue(score float64) int64 { return int64(score) }
+
+// rankedBoard describes a score-ordered zset leaderboard and how to report it
+type rankedBoard struct {
+	Key          string
+	Field        string
+	Value        func(float64) int64
+	Period       string
+	ErrorMessage string
+}
+
+// RecordWindowed adds amount to the user's entry in every time window of board
+func RecordWindowed(ctx context.Context, rdb *redis.Client, board string, userID string, amount int64) {
+	if amount <= 0 {
 		return
 	}
+	now := time.Now()
+	pipe := rdb.Pipeline()
+	for _, period := range core.LeaderboardWindows {
+		key := core.LeaderboardWindowKey(board, period, now)
+		pipe.ZIncrBy(ctx, key, float64(amount), userID)
+		pipe.ExpireNX(ctx, key, core.LeaderboardWindowRetention(period))
+	}
+	pipe.Exec(ctx)
+}
+
+// leaderboardPeriod reads the period query parameter, defaulting to all time
+func leaderboardPeriod(r *http.Request) (string, bool) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		return core.LeaderboardPeriodAll, true
+	}
+	return period, core.ValidLeaderboardPeriod(period)
+}
+
+// windowedBoard returns the all-time key for period "all" and the current
+// window's zset otherwise
+func windowedBoard(allTimeKey string, board string, period string) string {
+	if period == core.LeaderboardPeriodAll {
+		return allTimeKey
+	}
+	return core.LeaderboardWindowKey(board, period, time.Now())
+}
+
+// scopedBoard resolves the scope query parameter to the zset to rank from. For
+// the language and country scopes this is a short-lived view intersecting the
+// board with the players sharing the caller's language or country.
+func (h *Leaderboard) scopedBoard(ctx context.Context, r *http.Request, boardKey string, userID string) (key string, scope string, value string, ok bool) {
+	scope = r.URL.Query().Get("scope")
+	switch scope {
+	case "", core.LeaderboardScopeGlobal:
+		return boardKey, core.LeaderboardScopeGlobal, "", true
+	case core.LeaderboardScopeLanguage, core.LeaderboardScopeCountry:
+	default:
+		return "", scope, "", false
+	}
+	value, _ = h.RDB.HGet(ctx, "profile:"+userID, scope).Result()
+	if value == "" {
+		return "", scope, "", false
+	}
+	key = core.ScopedLeaderboardKey(boardKey, scope, value)
+	if exists, err := h.RDB.Exists(ctx, key).Result(); err == nil && exists == 0 {
+		// Set members score 1; weight 0 keeps the board's own scores
+		h.RDB.ZInterStore(ctx, key, &redis.ZStore{
+			Keys:    []string{boardKey, core.ScopeMembersKey(scope, value)},
+			Weights: []float64{1, 0},
+		})
+		h.RDB.Expire(ctx, key, core.LeaderboardScopeViewTTL)
+	}
+	return key, scope, value, true
+}
+
+// visibleBoard returns a short-lived view of boardKey without the players in
+// leaderboard_excluded, or boardKey itself when nobody is excluded. Shadow-banned
+// viewers get a view of their own that keeps them, so they still find
+// themselves on it while everyone else excluded stays hidden.
+func visibleBoard(ctx context.Context, rdb *redis.Client, boardKey string, viewerID string) string {
+	if n, err := rdb.SCard(ctx, "leaderboard_excluded").Result(); err != nil || n == 0 {
+		return boardKey
+	}
+	key := "leaderboard_visible:" + boardKey
+	banned, _ := rdb.SIsMember(ctx, "shadow_banned", viewerID).Result()
+	if banned {
+		key += ":" + viewerID
+	}
+	if exists, err := rdb.Exists(ctx, key).Result(); err == nil && exists == 0 {
+		self, selfErr := rdb.ZScore(ctx, boardKey, viewerID).Result()
+		rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZDiffStore(ctx, key, boardKey, "leaderboard_excluded")
+			if banned && selfErr == nil {
+				pipe.ZAdd(ctx, key, redis.Z{Score: self, Member: viewerID})
+			}
+			pipe.Expire(ctx, key, core.LeaderboardExclusionTTL)
+			return nil
+		})
+	}
+	return key
+}
+
+// serveRankedZSet serves a page of a score-ordered zset leaderboard
+func (h *Leaderboard) serveRankedZSet(w http.ResponseWriter, r *http.Request, board rankedBoard) {
+	session := CurrentSession(r)
 	currentUserID := session.UserID
 	ctx := context.Background()
-	results, err := h.RDB.ZRevRangeWithScores(ctx, "leaderboard", 0, -1).Result()
+	key, scope, scopeValue, ok := h.scopedBoard(ctx, r, board.Key, currentUserID)
+	if !ok {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	board.Key = visibleBoard(ctx, h.RDB, key, currentUserID)
+	page := parseLeaderboardPage(r)
+	selfRank := int64(-1)
+	var selfValue float64
+	if rank, err := h.RDB.ZRevRank(ctx, board.Key, currentUserID).Result(); err == nil {
+		selfRank = rank
+		selfValue, _ = h.RDB.ZScore(ctx, board.Key, currentUserID).Result()
+	}
+	start, stop := page.bounds(selfRank)
+	results, err := h.RDB.ZRevRangeWithScores(ctx, board.Key, start, stop).Result()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch leaderboard"})
+		json.NewEncoder(w).Encode(map[string]string{"error": board.ErrorMessage})
 		return
 	}
-	var entries []map[string]interface{}
-	for _, z := range results {
-		userID := z.Member.(string)
-		rate, err := h.Prod.GetUserProductionRate(userID)
-		if err != nil { rate = 0 }
-		entries = append(entries, map[string]interface{}{
-			"user_id": core.MaskTelegramID(userID),
-			"production_rate": rate,
-			"is_self": userID == currentUserID,
-		})
+	total, _ := h.RDB.ZCard(ctx, board.Key).Result()
+	names := rankedNames(ctx, h.RDB, results, currentUserID)
+	out := rankedPage(results, start, total, board.Field, board.Value, names, currentUserID, selfRank, selfValue)
+	out["period"] = board.Period
+	out["scope"] = scope
+	if scopeValue != "" {
+		out["scope_value"] = scopeValue
 	}
-	sort.Slice(entries, func(i, j int) bool {
-		ri := entries[i]["production_rate"].(int)
-		rj := entries[j]["production_rate"].(int)
-		return ri > rj
-	})
-	if len(entries) > 20 { entries = entries[:20] }
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(entries)
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleLeaderboard ranks players by score, or by score earned within a period
+func (h *Leaderboard) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	period, ok := leaderboardPeriod(r)
+	if !ok { http.Error(w, "bad request", http.StatusBadRequest); return }
+	h.serveRankedZSet(w, r, rankedBoard{
+		Key:          windowedBoard("leaderboard", core.LeaderboardBoardEarned, period),
+		Field:        "score",
+		Value:        scoreValue,
+		Period:       period,
+		ErrorMessage: "Failed to fetch leaderboard",
+	})
 }
 
+// HandlePerSecond ranks players by production rate. The stored rates exclude
+// community buffs, which scale everyone alike and are applied on the way out.
+// Rates are instantaneous, so only the all-time period applies.
+func (h *Leaderboard) HandlePerSecond(w http.ResponseWriter, r *http.Request) {
+	period, ok := leaderboardPeriod(r)
+	if !ok || period != core.LeaderboardPeriodAll { http.Error(w, "bad request", http.StatusBadRequest); return }
+	buff := communityBuffPercent(context.Background(), h.RDB)
+	h.serveRankedZSet(w, r, rankedBoard{
+		Key:          "production_rate",
+		Field:        "production_rate",
+		Value:        func(rate float64) int64 { return int64(withCommunityBuffs(int(rate), buff)) },
+		Period:       period,
+		ErrorMessage: "Failed to fetch leaderboard",
+	})
+}
+
+// HandleClicks ranks players by clicks, all time or within a period
 func (h *Leaderboard) HandleClicks(w http.ResponseWriter, r *http.Request) {
-	session, err := h.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
-	currentUserID := session.UserID
+	period, ok := leaderboardPeriod(r)
+	if !ok { http.Error(w, "bad request", http.StatusBadRequest); return }
+	h.serveRankedZSet(w, r, rankedBoard{
+		Key:          windowedBoard("clicks_leaderboard", core.LeaderboardBoardClicks, period),
+		Field:        "clicks",
+		Value:        scoreValue,
+		Period:       period,
+		ErrorMessage: "Failed to fetch clicks leaderboard",
+	})
+}
+
+func (h *Leaderboard) HandleGuilds(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
 	ctx := context.Background()
-	results, err := h.RDB.ZRevRangeWithScores(ctx, "clicks_leaderboard", 0, 19).Result()
+	ownGuild, _ := h.RDB.Get(ctx, "user_guild:"+session.UserID).Result()
+	results, err := h.RDB.ZRevRangeWithScores(ctx, "guild_leaderboard", 0, core.LeaderboardPageSize-1).Result()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch clicks leaderboard"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch guild leaderboard"})
 		return
 	}
 	entries := make([]map[string]interface{}, len(results))
 	for i, z := range results {
-		userID := z.Member.(string)
+		guildID := z.Member.(string)
+		name, _ := h.RDB.HGet(ctx, "guild:"+guildID, "name").Result()
+		members, _ := h.RDB.HLen(ctx, "guild_members:"+guildID).Result()
+		id, _ := strconv.ParseInt(guildID, 10, 64)
 		entries[i] = map[string]interface{}{
-			"user_id": core.MaskTelegramID(userID),
-			"clicks": int64(z.Score),
-			"is_self": userID == currentUserID,
+			"guild_id": id,
+			"name": name,
+			"members": members,
+			"score": int64(z.Score),
+			"is_self": guildID == ownGuild,
 		}
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Market struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewMarket(rdb *redis.Client, auth *Auth) *Market { return &Market{RDB: rdb, Auth: auth} }
+
+// listProducerScript moves producer units into escrow and indexes the listing.
+// KEYS: producer count, market_next_id, market_listings, market_listings:<pid>, market_expiry, market_user_listings:<uid>
+// ARGV: seller, producer ID, quantity, unit price, total, fee, now, expires at, max listings
+// Returns {listingID, remainingOwned}, or {-1,owned} not enough units, {-2,0} too many listings.
+var listProducerScript = redis.NewScript(`
+local owned = tonumber(redis.call('GET', KEYS[1]) or '0')
+local qty = tonumber(ARGV[3])
+if owned < qty then return {-1, owned} end
+if redis.call('SCARD', KEYS[6]) >= tonumber(ARGV[9]) then return {-2, 0} end
+redis.call('DECRBY', KEYS[1], ARGV[3])
+local id = redis.call('INCR', KEYS[2])
+redis.call('HSET', 'market_listing:' .. id, 'seller', ARGV[1], 'producer_id', ARGV[2], 'quantity', ARGV[3],
+	'unit_price', ARGV[4], 'total', ARGV[5], 'fee', ARGV[6], 'created_at', ARGV[7], 'expires_at', ARGV[8])
+redis.call('ZADD', KEYS[3], ARGV[4], id)
+redis.call('ZADD', KEYS[4], ARGV[4], id)
+redis.call('ZADD', KEYS[5], ARGV[8], id)
+redis.call('SADD', KEYS[6], id)
+return {id, owned - qty}
+`)
+
+// buyListingScript settles a listing: charges the buyer, pays the seller minus
+// the fee, releases the escrowed units to the buyer and removes the listing.
+// KEYS: market_listing:<id>, buyer, leaderboard, market_listings, market_expiry
+// ARGV: listing ID, now
+// Returns {1, buyerScore, producerID, quantity}, or {-1} gone, {-2} own listing, {-3} expired, {-4, score} insufficient score.
+var buyListingScript = redis.NewScript(`
+local l = redis.call('HMGET', KEYS[1], 'seller', 'producer_id', 'quantity', 'total', 'fee', 'expires_at')
+if not l[1] then return {-1, 0, 0, 0} end
+local seller, pid, qty, total, fee = l[1], l[2], tonumber(l[3]), tonumber(l[4]), tonumber(l[5])
+if seller == KEYS[2] then return {-2, 0, 0, 0} end
+if tonumber(l[6]) <= tonumber(ARGV[2]) then return {-3, 0, 0, 0} end
+local score = tonumber(redis.call('GET', KEYS[2]) or '0')
+if score < total then return {-4, score, 0, 0} end
+local buyerScore = redis.call('DECRBY', KEYS[2], l[4])
+local sellerScore = redis.call('INCRBY', seller, string.format('%d', total - fee))
+redis.call('INCRBY', 'score_credits:' .. seller, string.format('%d', total - fee))
+redis.call('ZADD', KEYS[3], buyerScore, KEYS[2], sellerScore, seller)
+redis.call('INCRBY', 'producer:' .. KEYS[2] .. ':' .. pid, l[3])
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('ZREM', 'market_listings:' .. pid, ARGV[1])
+redis.call('ZREM', KEYS[5], ARGV[1])
+redis.call('SREM', 'market_user_listings:' .. seller, ARGV[1])
+return {1, buyerScore, tonumber(pid), qty}
+`)
+
+// cancelListingScript returns escrowed units to the seller and removes the listing.
+// With a seller in ARGV[2] only that seller may cancel; with an empty seller the
+// listing is only removed once expired (used by the expiry sweep).
+// KEYS: market_listing:<id>, market_listings, market_expiry
+// ARGV: listing ID, seller or '', now
+// Returns quantity returned, or -1 gone, -2 not the seller, -3 not yet expired.
+var cancelListingScript = redis.NewScript(`
+local l = redis.call('HMGET', KEYS[1], 'seller', 'producer_id', 'quantity', 'expires_at')
+if not l[1] then return -1 end
+if ARGV[2] ~= '' and l[1] ~= ARGV[2] then return -2 end
+if ARGV[2] == '' and tonumber(l[4]) > tonumber(ARGV[3]) then return -3 end
+redis.call('INCRBY', 'producer:' .. l[1] .. ':' .. l[2], l[3])
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', 'market_listings:' .. l[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('SREM', 'market_user_listings:' .. l[1], ARGV[1])
+return tonumber(l[3])
+`)
+
+// loadListing reads a listing, returning nil when it no longer exists
+func (m *Market) loadListing(ctx context.Context, id string, currentUserID string) *core.MarketListing {
+	data, err := m.RDB.HGetAll(ctx, "market_listing:"+id).Result()
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	l := &core.MarketListing{SellerID: core.MaskTelegramID(data["seller"]), IsSelf: data["seller"] == currentUserID}
+	l.ID, _ = strconv.ParseInt(id, 10, 64)
+	l.ProducerID, _ = strconv.Atoi(data["producer_id"])
+	l.Quantity, _ = strconv.Atoi(data["quantity"])
+	l.UnitPrice, _ = strconv.ParseInt(data["unit_price"], 10, 64)
+	l.TotalPrice, _ = strconv.ParseInt(data["total"], 10, 64)
+	l.CreatedAt, _ = strconv.ParseInt(data["created_at"], 10, 64)
+	l.ExpiresAt, _ = strconv.ParseInt(data["expires_at"], 10, 64)
+	return l
+}
+
+// ExpireListings returns escrowed units for every listing past its expiry
+func (m *Market) ExpireListings() {
+	ctx := context.Background()
+	now := time.Now().Unix()
+	ids, err := m.RDB.ZRangeByScore(ctx, "market_expiry", &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now, 10)}).Result()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		seller, _ := m.RDB.HGet(ctx, "market_listing:"+id, "seller").Result()
+		returned, err := cancelListingScript.Run(ctx, m.RDB, []string{"market_listing:" + id, "market_listings", "market_expiry"}, id, "", now).Int64()
+		if err == nil && returned > 0 && seller != "" {
+			UpdateProductionRate(ctx, m.RDB, seller)
+		}
+	}
+}
+
+// HandleSearch lists active listings, optionally filtered by producer and unit price range
+func (m *Market) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	q := r.URL.Query()
+	key := "market_listings"
+	if pidStr := q.Get("producer_id"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || core.FindProducer(pid) == nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+		key = "market_listings:" + pidStr
+	}
+	minPrice, maxPrice := "-inf", "+inf"
+	if v := q.Get("min_price"); v != "" {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+		minPrice = v
+	}
+	if v := q.Get("max_price"); v != "" {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+		maxPrice = v
+	}
+	offset, _ := strconv.ParseInt(q.Get("offset"), 10, 64)
+	if offset < 0 { offset = 0 }
+	// Return expired listings first so pages and the total only count live ones
+	m.ExpireListings()
+	ids, err := m.RDB.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: minPrice, Max: maxPrice, Offset: offset, Count: core.MarketPageSize}).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	now := time.Now().Unix()
+	listings := make([]*core.MarketListing, 0, len(ids))
+	for _, id := range ids {
+		if l := m.loadListing(ctx, id, session.UserID); l != nil && l.ExpiresAt > now {
+			listings = append(listings, l)
+		}
+	}
+	total, _ := m.RDB.ZCount(ctx, key, minPrice, maxPrice).Result()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"listings": listings,
+		"total": total,
+		"offset": offset,
+		"fee_percent": core.MarketFeePercent,
+	})
+}
+
+// HandleMine lists the caller's own active listings
+func (m *Market) HandleMine(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	ids, err := m.RDB.SMembers(ctx, "market_user_listings:"+session.UserID).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	listings := make([]*core.MarketListing, 0, len(ids))
+	for _, id := range ids {
+		if l := m.loadListing(ctx, id, session.UserID); l != nil {
+			listings = append(listings, l)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listings)
+}
+
+// HandleList escrows producer units from the caller and puts them up for sale
+func (m *Market) HandleList(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { ProducerID int `json:"producer_id"`; Quantity int `json:"quantity"`; UnitPrice int64 `json:"unit_price"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Quantity <= 0 || req.UnitPrice <= 0 || req.UnitPrice > core.MarketMaxPrice { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if core.FindProducer(req.ProducerID) == nil { http.Error(w, "producer not found", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	pidStr := strconv.Itoa(req.ProducerID)
+	// Bound the quantity by what the seller owns and the total by what Lua
+	// represents exactly, before the multiplication can overflow
+	owned, err := m.RDB.Get(ctx, "producer:"+userID+":"+pidStr).Int64()
+	if err != nil && err != redis.Nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if int64(req.Quantity) > owned {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not enough producers owned", "owned": owned})
+		return
+	}
+	if req.UnitPrice > core.MarketMaxTotal/int64(req.Quantity) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "listing total too large"})
+		return
+	}
+	now := time.Now()
+	expiresAt := now.Add(core.MarketListingTTL).Unix()
+	total := req.UnitPrice * int64(req.Quantity)
+	fee := core.CalculateMarketFee(total)
+	keys := []string{
+		"producer:" + userID + ":" + pidStr,
+		"market_next_id",
+		"market_listings",
+		"market_listings:" + pidStr,
+		"market_expiry",
+		"market_user_listings:" + userID,
+	}
+	res, err := listProducerScript.Run(ctx, m.RDB, keys, userID, req.ProducerID, req.Quantity, req.UnitPrice, total, fee, now.Unix(), expiresAt, core.MarketMaxListingsPerUser).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "not enough producers owned", "owned": res[1]})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "too many active listings"})
+		return
+	}
+	UpdateProductionRate(ctx, m.RDB, userID)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"listing": m.loadListing(ctx, strconv.FormatInt(res[0], 10), userID),
+		"owned": res[1],
+		"fee": fee,
+	})
+}
+
+// HandleBuy settles a listing for the caller
+func (m *Market) HandleBuy(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { ListingID int64 `json:"listing_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ListingID <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	idStr := strconv.FormatInt(req.ListingID, 10)
+	keys := []string{"market_listing:" + idStr, userID, "leaderboard", "market_listings", "market_expiry"}
+	res, err := buyListingScript.Run(ctx, m.RDB, keys, idStr, time.Now().Unix()).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1, -3:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "listing no longer available"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "cannot buy your own listing"})
+		return
+	case -4:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1]})
+		return
+	}
+	UpdateProductionRate(ctx, m.RDB, userID)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"score": res[1],
+		"producer_id": res[2],
+		"quantity": res[3],
+	})
+}
+
+// HandleCancel withdraws one of the caller's listings and returns the units
+func (m *Market) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { ListingID int64 `json:"listing_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ListingID <= 0 { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	idStr := strconv.FormatInt(req.ListingID, 10)
+	keys := []string{"market_listing:" + idStr, "market_listings", "market_expiry"}
+	res, err := cancelListingScript.Run(ctx, m.RDB, keys, idStr, session.UserID, time.Now().Unix()).Int64()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if res == -1 || res == -2 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "listing not found"})
+		return
+	}
+	UpdateProductionRate(ctx, m.RDB, session.UserID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "returned": res})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	core "neon-clicker/core"
+)
+
+// AuthPolicy says who may call a route
+type AuthPolicy int
+
+const (
+	// PolicyPublic serves everyone; the session is attached when the caller authenticated
+	PolicyPublic AuthPolicy = iota
+	// PolicyUser requires an authenticated user
+	PolicyUser
+	// PolicyAdmin requires an authenticated admin
+	PolicyAdmin
+)
+
+type sessionContextKey struct{}
+
+// WithSession returns a copy of ctx carrying the authenticated session
+func WithSession(ctx context.Context, session *core.Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// SessionFromContext returns the session attached by Auth.Middleware, if any
+func SessionFromContext(ctx context.Context) (*core.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey{}).(*core.Session)
+	return session, ok && session != nil
+}
+
+// CurrentSession returns the caller's session in handlers behind PolicyUser or
+// PolicyAdmin, where the middleware guarantees one is present
+func CurrentSession(r *http.Request) *core.Session {
+	session, _ := SessionFromContext(r.Context())
+	return session
+}
+
+// Middleware authenticates the request once, enforces policy and attaches the
+// session to the request context. Callers who authenticated through a provider
+// rather than a session token receive their device's session in X-Session-ID.
+func (a *Auth) Middleware(policy AuthPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := a.AuthenticateRequest(r)
+		if err != nil {
+			if policy == PolicyPublic {
+				next(w, r)
+				return
+			}
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if policy == PolicyAdmin && !a.IsAdmin(session.UserID) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if session.ID == "" {
+			if a.markUserCreated(r.Context(), session.UserID) {
+				for _, fn := range a.NewUserHooks {
+					fn(r.Context(), session)
+				}
+			}
+			if token, err := a.SessionForDevice(session.UserID, session.TelegramUser, session.Device); err == nil {
+				w.Header().Set("X-Session-ID", token)
+			}
+		}
+		next(w, r.WithContext(WithSession(r.Context(), session)))
+	}
+}
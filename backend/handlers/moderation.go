@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// leaderboardInclusionScript lifts one reason a user is excluded and restores
+// them to leaderboards once no reason is left.
+// KEYS: leaderboard_exclusion:<uid>, leaderboard_excluded
+// ARGV: user ID, reason
+// Returns 1 when the user is visible again, 0 otherwise.
+var leaderboardInclusionScript = redis.NewScript(`
+redis.call('SREM', KEYS[1], ARGV[2])
+if redis.call('SCARD', KEYS[1]) > 0 then return 0 end
+redis.call('SREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+// excludeFromLeaderboards hides the user from leaderboards and donor lists for reason
+func excludeFromLeaderboards(ctx context.Context, rdb *redis.Client, userID string, reason string) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, "leaderboard_exclusion:"+userID, reason)
+		pipe.SAdd(ctx, "leaderboard_excluded", userID)
+		return nil
+	})
+	return err
+}
+
+// includeInLeaderboards lifts reason; the user reappears once nothing else keeps them hidden
+func includeInLeaderboards(ctx context.Context, rdb *redis.Client, userID string, reason string) error {
+	return leaderboardInclusionScript.Run(ctx, rdb, []string{"leaderboard_exclusion:" + userID, "leaderboard_excluded"}, userID, reason).Err()
+}
+
+type Moderation struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewModeration(rdb *redis.Client, auth *Auth) *Moderation { return &Moderation{RDB: rdb, Auth: auth} }
+
+// HandleFlagged lists players flagged by click checks and awaiting review
+func (m *Moderation) HandleFlagged(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	raw, err := m.RDB.HGetAll(ctx, "click_flags").Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	flags := make([]core.ClickFlag, 0, len(raw))
+	for _, item := range raw {
+		var f core.ClickFlag
+		if json.Unmarshal([]byte(item), &f) == nil {
+			flags = append(flags, f)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].FlaggedAt > flags[j].FlaggedAt })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
+
+// HandleReview resolves a flag: "clear" restores the player to the leaderboards
+// and resets their strikes, "confirm" keeps them excluded. A confirmed player
+// can still be cleared later.
+func (m *Moderation) HandleReview(w http.ResponseWriter, r *http.Request) {
+	var req struct { UserID string `json:"user_id"`; Action string `json:"action"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	flagged, err := m.RDB.HExists(ctx, "click_flags", req.UserID).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if !flagged && req.Action == "clear" {
+		// Confirmed flags are gone from click_flags but keep their exclusion reason
+		flagged, err = m.RDB.SIsMember(ctx, "leaderboard_exclusion:"+req.UserID, core.LeaderboardExclusionClicks).Result()
+		if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	}
+	if !flagged { http.Error(w, "not found", http.StatusNotFound); return }
+	switch req.Action {
+	case "clear":
+		_, err = m.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, "click_flags", req.UserID)
+			pipe.Del(ctx, "click_strikes:"+req.UserID, "click_throttled:"+req.UserID)
+			return nil
+		})
+		if err == nil {
+			err = includeInLeaderboards(ctx, m.RDB, req.UserID, core.LeaderboardExclusionClicks)
+		}
+	case "confirm":
+		if err = excludeFromLeaderboards(ctx, m.RDB, req.UserID, core.LeaderboardExclusionClicks); err == nil {
+			err = m.RDB.HDel(ctx, "click_flags", req.UserID).Err()
+		}
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// HandleShadowBans lists shadow-banned players
+func (m *Moderation) HandleShadowBans(w http.ResponseWriter, r *http.Request) {
+	ids, err := m.RDB.SMembers(context.Background(), "shadow_banned").Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	sort.Strings(ids)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"user_ids": ids})
+}
+
+// HandleShadowBan hides a player from every leaderboard and donor list while
+// they keep playing normally, or lifts the ban
+func (m *Moderation) HandleShadowBan(w http.ResponseWriter, r *http.Request) {
+	var req struct { UserID string `json:"user_id"`; Banned bool `json:"banned"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	var err error
+	if req.Banned {
+		if err = m.RDB.SAdd(ctx, "shadow_banned", req.UserID).Err(); err == nil {
+			err = excludeFromLeaderboards(ctx, m.RDB, req.UserID, core.LeaderboardExclusionShadowBan)
+		}
+	} else {
+		if err = m.RDB.SRem(ctx, "shadow_banned", req.UserID).Err(); err == nil {
+			err = includeInLeaderboards(ctx, m.RDB, req.UserID, core.LeaderboardExclusionShadowBan)
+		}
+	}
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "user_id": req.UserID, "banned": req.Banned})
+}
@@ -22,15 +22,7 @@ func NewProducers(rdb *redis.Client, auth *Auth) *Producers {
 
 // GetUserProductionRate calculates user's total production rate per second
 func (p *Producers) GetUserProductionRate(userID string) (int, error) {
-	producers, err := p.GetUserProducers(userID)
-	if err != nil {
-		return 0, err
-	}
-	totalProduction := 0
-	for _, producer := range producers {
-		totalProduction += core.LineProduction(producer.Rate, producer.Owned)
-	}
-	return totalProduction, nil
+	return p.GetTotalProduction(userID)
 }
 
 // GetUserProducers returns user's producers enriched with owned counts, costs, and build times
@@ -63,26 +55,80 @@ func (p *Producers) GetUserProducers(userID string) ([]core.Producer, error) {
 	return producers, nil
 }
 
-// GetTotalProduction calculates total production for a user
-func (p *Producers) GetTotalProduction(userID string) (int, error) {
-	producers, err := p.GetUserProducers(userID)
+// ownedProduction is the base output of every producer the user owns
+func ownedProduction(ctx context.Context, rdb *redis.Client, userID string) (int, error) {
+	keys := make([]string, len(core.DefaultProducers))
+	for i, pr := range core.DefaultProducers {
+		keys[i] = "producer:" + userID + ":" + strconv.Itoa(pr.ID)
+	}
+	owned, err := rdb.MGet(ctx, keys...).Result()
 	if err != nil {
 		return 0, err
 	}
 	total := 0
-	for _, pr := range producers {
-		total += core.LineProduction(pr.Rate, pr.Owned)
+	for i, pr := range core.DefaultProducers {
+		if v, ok := owned[i].(string); ok {
+			n, _ := strconv.Atoi(v)
+			total += core.LineProduction(pr.Rate, n)
+		}
 	}
 	return total, nil
 }
 
-// HTTP handlers
-func (p *Producers) HandleGetProducers(w http.ResponseWriter, r *http.Request) {
-	session, err := p.Auth.AuthenticateRequest(r)
+// personalProduction is the user's production with their guild bonus applied.
+// Community buffs are left out: they scale every player alike.
+func personalProduction(ctx context.Context, rdb *redis.Client, userID string) (int, error) {
+	total, err := ownedProduction(ctx, rdb, userID)
+	if err != nil {
+		return 0, err
+	}
+	if bonus := guildBonusPercent(ctx, rdb, userID); bonus > 0 {
+		total = total * (100 + bonus) / 100
+	}
+	return total, nil
+}
+
+// withCommunityBuffs applies the active community buffs to a personal production rate
+func withCommunityBuffs(rate int, buffPercent int) int {
+	return rate * (100 + buffPercent) / 100
+}
+
+// UpdateProductionRate refreshes the user's entry in the production_rate
+// leaderboard. Call it whenever owned producers or the guild bonus change.
+func UpdateProductionRate(ctx context.Context, rdb *redis.Client, userID string) {
+	rate, err := personalProduction(ctx, rdb, userID)
+	if err != nil {
+		return
+	}
+	rdb.ZAdd(ctx, "production_rate", redis.Z{Score: float64(rate), Member: userID})
+}
+
+// RebuildProductionRates recomputes the production_rate leaderboard for every player
+func (p *Producers) RebuildProductionRates() {
+	ctx := context.Background()
+	users, err := p.RDB.ZRange(ctx, "leaderboard", 0, -1).Result()
 	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
 		return
 	}
+	for _, userID := range users {
+		UpdateProductionRate(ctx, p.RDB, userID)
+	}
+}
+
+// GetTotalProduction calculates total production for a user: the guild bonus
+// and then the community buffs are applied on top of their producers' output
+func (p *Producers) GetTotalProduction(userID string) (int, error) {
+	ctx := context.Background()
+	total, err := personalProduction(ctx, p.RDB, userID)
+	if err != nil {
+		return 0, err
+	}
+	return withCommunityBuffs(total, communityBuffPercent(ctx, p.RDB)), nil
+}
+
+// HTTP handlers
+func (p *Producers) HandleGetProducers(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
 	user := session.UserID
 	producers, err := p.GetUserProducers(user)
 	if err != nil {
@@ -94,11 +140,7 @@ func (p *Producers) HandleGetProducers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *Producers) HandleBuyProducer(w http.ResponseWriter, r *http.Request) {
-	session, err := p.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
+	session := CurrentSession(r)
 	var req struct { ProducerID int `json:"producer_id"` }
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProducerID == 0 {
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -106,9 +148,7 @@ func (p *Producers) HandleBuyProducer(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := session.UserID
 	ctx := context.Background()
-	// Get current score (default to 10000 for brand new users)
-	score, errScore := p.RDB.Get(ctx, userID).Int()
-	if errScore != nil { score = 10000 }
+	score, _ := p.RDB.Get(ctx, userID).Int()
 	// Get current producers
 	producers, err := p.GetUserProducers(userID)
 	if err != nil {
@@ -155,17 +195,40 @@ func (p *Producers) HandleBuyProducer(w http.ResponseWriter, r *http.Request) {
 		buildTime = 0
 	}
 	now := time.Now().Unix()
+	buildKey := "producer_build_end:" + userID + ":" + strconv.Itoa(req.ProducerID)
+	if buildTime > 0 {
+		// Claim the build slot first so concurrent purchases cannot both start it
+		claimed, err := p.RDB.SetNX(ctx, buildKey, now+int64(buildTime), 0).Result()
+		if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+		if !claimed {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "producer building in progress",
+				"producers": producers,
+				"score": score,
+			})
+			return
+		}
+	}
 	// Deduct cost
-	newScore := score - producer.Cost
-	p.RDB.Set(ctx, userID, newScore, 0)
-	// Update leaderboard
-	p.RDB.ZAdd(ctx, "leaderboard", redis.Z{Score: float64(newScore), Member: userID})
+	newScore, ok, err := SpendScore(ctx, p.RDB, userID, int64(producer.Cost))
+	if err != nil || !ok {
+		if buildTime > 0 {
+			p.RDB.Del(ctx, buildKey)
+		}
+		if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "insufficient score",
+			"producers": producers,
+			"score": newScore,
+		})
+		return
+	}
 	if buildTime == 0 {
 		// Instant purchase
-		owned, err := p.RDB.Get(ctx, "producer:"+userID+":"+strconv.Itoa(req.ProducerID)).Int()
-		if err != nil { owned = 0 }
-		newOwned := owned + 1
-		p.RDB.Set(ctx, "producer:"+userID+":"+strconv.Itoa(req.ProducerID), newOwned, 0)
+		p.RDB.Incr(ctx, "producer:"+userID+":"+strconv.Itoa(req.ProducerID))
+		UpdateProductionRate(ctx, p.RDB, userID)
 		updated, _ := p.GetUserProducers(userID)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": true,
@@ -176,9 +239,7 @@ func (p *Producers) HandleBuyProducer(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	// Delayed purchase
-	buildEnd := now + int64(buildTime)
-	p.RDB.Set(ctx, "producer_build_end:"+userID+":"+strconv.Itoa(req.ProducerID), buildEnd, 0)
+	// Delayed purchase: the build slot claimed above completes it
 	updated, _ := p.GetUserProducers(userID)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -190,11 +251,7 @@ func (p *Producers) HandleBuyProducer(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *Producers) HandleGetProduction(w http.ResponseWriter, r *http.Request) {
-	session, err := p.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
+	session := CurrentSession(r)
 	user := session.UserID
 	production, err := p.GetTotalProduction(user)
 	if err != nil {
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Profiles struct {
+	RDB       *redis.Client
+	Auth      *Auth
+	Blocklist []string
+}
+
+// NewProfiles builds the profile handlers; blocklist extends core.DefaultDisplayNameBlocklist
+func NewProfiles(rdb *redis.Client, auth *Auth, blocklist []string) *Profiles {
+	words := append([]string{}, core.DefaultDisplayNameBlocklist...)
+	for _, w := range blocklist {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			words = append(words, w)
+		}
+	}
+	return &Profiles{RDB: rdb, Auth: auth, Blocklist: words}
+}
+
+// claimDisplayNameScript reserves a display name for the user, releasing their
+// previous one, and makes their profile public.
+// KEYS: display_names, profile:<uid>
+// ARGV: name key, name, user ID
+// Returns 1 on success or -1 when another player holds the name.
+var claimDisplayNameScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], ARGV[1])
+if owner and owner ~= ARGV[3] then return -1 end
+local oldKey = redis.call('HGET', KEYS[2], 'display_name_key')
+if oldKey and oldKey ~= ARGV[1] then redis.call('HDEL', KEYS[1], oldKey) end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('HSET', KEYS[2], 'display_name', ARGV[2], 'display_name_key', ARGV[1], 'public', '1')
+return 1
+`)
+
+// setProfileScope records a profile attribute used for scoped leaderboards
+// (language or country), moving the user between scope member sets. An empty
+// value clears it.
+func setProfileScope(ctx context.Context, rdb *redis.Client, userID string, scope string, value string) {
+	old, _ := rdb.HGet(ctx, "profile:"+userID, scope).Result()
+	if old == value {
+		return
+	}
+	rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if old != "" {
+			pipe.SRem(ctx, core.ScopeMembersKey(scope, old), userID)
+		}
+		if value == "" {
+			pipe.HDel(ctx, "profile:"+userID, scope)
+			return nil
+		}
+		pipe.SAdd(ctx, core.ScopeMembersKey(scope, value), userID)
+		pipe.HSet(ctx, "profile:"+userID, scope, value)
+		return nil
+	})
+}
+
+// displayNames returns the display names of the users who made theirs public, keyed by user ID
+func displayNames(ctx context.Context, rdb *redis.Client, userIDs []string) map[string]string {
+	names := make(map[string]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return names
+	}
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(userIDs))
+	for i, id := range userIDs {
+		cmds[i] = pipe.HMGet(ctx, "profile:"+id, "display_name", "public")
+	}
+	pipe.Exec(ctx)
+	for i, id := range userIDs {
+		vals := cmds[i].Val()
+		if len(vals) < 2 {
+			continue
+		}
+		name, _ := vals[0].(string)
+		public, _ := vals[1].(string)
+		if name != "" && public == "1" {
+			names[id] = name
+		}
+	}
+	return names
+}
+
+// publicName is what other players see: the user's display name when public,
+// otherwise their masked ID
+func publicName(names map[string]string, userID string) string {
+	if name, ok := names[userID]; ok {
+		return name
+	}
+	return core.MaskTelegramID(userID)
+}
+
+// profile loads the caller's profile as shown to themselves
+func (p *Profiles) profile(ctx context.Context, session *core.Session) core.Profile {
+	data, _ := p.RDB.HGetAll(ctx, "profile:"+session.UserID).Result()
+	out := core.Profile{
+		DisplayName: data["display_name"],
+		Public:      data["public"] == "1",
+		Language:    data[core.LeaderboardScopeLanguage],
+		Country:     data[core.LeaderboardScopeCountry],
+		DefaultName: core.DefaultDisplayName(session.TelegramUser),
+	}
+	if ttl, err := p.RDB.TTL(ctx, "display_name_cooldown:"+session.UserID).Result(); err == nil && ttl > 0 {
+		out.NextRenameAt = time.Now().Add(ttl).Unix()
+	}
+	return out
+}
+
+// HandleGet returns the caller's display name settings
+func (p *Profiles) HandleGet(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.profile(context.Background(), session))
+}
+
+// HandleSetName opts the caller in with a display name, defaulting to their
+// Telegram username or first name. Renames are limited by core.DisplayNameRenameCooldown.
+func (p *Profiles) HandleSetName(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { Name string `json:"name"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = core.DefaultDisplayName(session.TelegramUser)
+	}
+	name, ok := core.NormalizeDisplayName(req.Name)
+	if !ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "invalid display name", "min_length": core.DisplayNameMinLength, "max_length": core.DisplayNameMaxLength})
+		return
+	}
+	if core.DisplayNameBlocked(name, p.Blocklist) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "display name not allowed"})
+		return
+	}
+	ctx := context.Background()
+	userID := session.UserID
+	current, _ := p.RDB.HGet(ctx, "profile:"+userID, "display_name").Result()
+	renaming := current != "" && current != name
+	cooldownKey := "display_name_cooldown:" + userID
+	if renaming {
+		allowed, err := p.RDB.SetNX(ctx, cooldownKey, time.Now().Unix(), core.DisplayNameRenameCooldown).Result()
+		if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+		if !allowed {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "display name was changed recently", "profile": p.profile(ctx, session)})
+			return
+		}
+	}
+	res, err := claimDisplayNameScript.Run(ctx, p.RDB, []string{"display_names", "profile:" + userID}, core.DisplayNameKey(name), name, userID).Int()
+	if err != nil || res == -1 {
+		if renaming {
+			p.RDB.Del(ctx, cooldownKey)
+		}
+		if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "display name taken"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "profile": p.profile(ctx, session)})
+}
+
+// HandleSetVisibility shows or hides the caller's display name on leaderboards.
+// A hidden name stays reserved.
+func (p *Profiles) HandleSetVisibility(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { Public bool `json:"public"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	if req.Public {
+		if name, _ := p.RDB.HGet(ctx, "profile:"+userID, "display_name").Result(); name == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "choose a display name first"})
+			return
+		}
+	}
+	public := "0"
+	if req.Public {
+		public = "1"
+	}
+	p.RDB.HSet(ctx, "profile:"+userID, "public", public)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "profile": p.profile(ctx, session)})
+}
+
+// HandleSetCountry sets or clears (with an empty code) the caller's self-declared country
+func (p *Profiles) HandleSetCountry(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { Country string `json:"country"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	country := ""
+	if strings.TrimSpace(req.Country) != "" {
+		code, ok := core.NormalizeCountryCode(req.Country)
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "invalid country code"})
+			return
+		}
+		country = code
+	}
+	ctx := context.Background()
+	setProfileScope(ctx, p.RDB, session.UserID, core.LeaderboardScopeCountry, country)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "profile": p.profile(ctx, session)})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type RankHistory struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewRankHistory(rdb *redis.Client, auth *Auth) *RankHistory { return &RankHistory{RDB: rdb, Auth: auth} }
+
+// rankHistoryBoards maps the board names accepted by the API to their zsets
+var rankHistoryBoards = map[string]string{
+	"score":           "leaderboard",
+	"production_rate": "production_rate",
+	"clicks":          "clicks_leaderboard",
+}
+
+func rankHistoryKey(resolution string, board string, userID string) string {
+	return "rank_history:" + resolution + ":" + board + ":" + userID
+}
+
+func rankHistoryRetention(resolution string) time.Duration {
+	if resolution == core.RankHistoryDaily {
+		return core.RankHistoryDailyRetention
+	}
+	return core.RankHistoryHourlyRetention
+}
+
+// Snapshot records every player's rank and score once per hour, and once per
+// day into the long-term series. Safe to call often: each bucket is taken once.
+func (rh *RankHistory) Snapshot() {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	first, err := rh.RDB.SetNX(ctx, "rank_snapshot:"+core.RankHistoryHourly+":"+hour.Format("2006010215"), hour.Unix(), core.RankHistoryHourlyRetention).Result()
+	if err != nil || !first {
+		return
+	}
+	resolutions := []string{core.RankHistoryHourly}
+	if daily, _ := rh.RDB.SetNX(ctx, "rank_snapshot:"+core.RankHistoryDaily+":"+core.DayKey(now), hour.Unix(), core.RankHistoryDailyRetention).Result(); daily {
+		resolutions = append(resolutions, core.RankHistoryDaily)
+	}
+	for board, key := range rankHistoryBoards {
+		rh.snapshotBoard(ctx, board, key, hour.Unix(), resolutions)
+	}
+}
+
+// snapshotBoard appends the current standings of one board to each player's
+// series, pruning points past the retention window. Ranks count visible
+// players only: excluded players are skipped, except that shadow-banned ones
+// get the rank they see on their own view of the board.
+func (rh *RankHistory) snapshotBoard(ctx context.Context, board string, key string, ts int64, resolutions []string) {
+	results, err := rh.RDB.ZRevRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	excluded, _ := rh.RDB.SMembers(ctx, "leaderboard_excluded").Result()
+	banned, _ := rh.RDB.SMembers(ctx, "shadow_banned").Result()
+	hidden := make(map[string]bool, len(excluded))
+	for _, uid := range excluded {
+		hidden[uid] = true
+	}
+	selfOnly := make(map[string]bool, len(banned))
+	for _, uid := range banned {
+		selfOnly[uid] = true
+	}
+	pipe := rh.RDB.Pipeline()
+	visible := int64(0)
+	for i, z := range results {
+		userID := z.Member.(string)
+		rank := visible + 1
+		if !hidden[userID] {
+			visible++
+		} else if !selfOnly[userID] {
+			continue
+		}
+		member := core.EncodeRankSnapshot(core.RankSnapshot{Time: ts, Rank: rank, Score: int64(z.Score)})
+		for _, res := range resolutions {
+			historyKey := rankHistoryKey(res, board, userID)
+			retention := rankHistoryRetention(res)
+			cutoff := ts - int64(retention.Seconds())
+			pipe.ZAdd(ctx, historyKey, redis.Z{Score: float64(ts), Member: member})
+			pipe.ZRemRangeByScore(ctx, historyKey, "-inf", "("+strconv.FormatInt(cutoff, 10))
+			pipe.Expire(ctx, historyKey, retention)
+		}
+		if (i+1)%core.RankSnapshotBatchSize == 0 {
+			pipe.Exec(ctx)
+			pipe = rh.RDB.Pipeline()
+		}
+	}
+	pipe.Exec(ctx)
+}
+
+// loadHistory returns a player's snapshots in chronological order
+func (rh *RankHistory) loadHistory(ctx context.Context, resolution string, board string, userID string) []core.RankSnapshot {
+	raw, err := rh.RDB.ZRange(ctx, rankHistoryKey(resolution, board, userID), 0, -1).Result()
+	if err != nil {
+		return nil
+	}
+	points := make([]core.RankSnapshot, 0, len(raw))
+	for _, member := range raw {
+		if s, ok := core.ParseRankSnapshot(member); ok {
+			points = append(points, s)
+		}
+	}
+	return points
+}
+
+// HandleGet returns the caller's rank history on a board
+// (?board=score|production_rate|clicks&resolution=hourly|daily) and how their
+// rank changed since the same time yesterday
+func (rh *RankHistory) HandleGet(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	q := r.URL.Query()
+	board := q.Get("board")
+	if board == "" {
+		board = "score"
+	}
+	key, ok := rankHistoryBoards[board]
+	if !ok { http.Error(w, "bad request", http.StatusBadRequest); return }
+	resolution := q.Get("resolution")
+	if resolution == "" {
+		resolution = core.RankHistoryHourly
+	}
+	if resolution != core.RankHistoryHourly && resolution != core.RankHistoryDaily { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	points := rh.loadHistory(ctx, resolution, board, userID)
+	out := map[string]interface{}{
+		"board": board,
+		"resolution": resolution,
+		"points": points,
+		"current": nil,
+		"yesterday_rank": nil,
+		"rank_delta": nil,
+	}
+	key = visibleBoard(ctx, rh.RDB, key, userID)
+	rank, err := rh.RDB.ZRevRank(ctx, key, userID).Result()
+	if err == nil {
+		score, _ := rh.RDB.ZScore(ctx, key, userID).Result()
+		out["current"] = core.RankSnapshot{Time: time.Now().Unix(), Rank: rank + 1, Score: int64(score)}
+		// Latest hourly snapshot at least a day old; positive delta means climbing
+		hourly := points
+		if resolution != core.RankHistoryHourly {
+			hourly = rh.loadHistory(ctx, core.RankHistoryHourly, board, userID)
+		}
+		dayAgo := time.Now().Add(-24 * time.Hour).Unix()
+		for i := len(hourly) - 1; i >= 0; i-- {
+			if hourly[i].Time <= dayAgo {
+				out["yesterday_rank"] = hourly[i].Rank
+				out["rank_delta"] = hourly[i].Rank - (rank + 1)
+				break
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
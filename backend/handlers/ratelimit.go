@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// Rejected requests, published on the metrics listener's /debug/vars: by route, and by what was
+// limited ("ip", "user" or "clicks")
+var (
+	rateLimitRejectedRoutes = expvar.NewMap("rate_limit_rejected_routes")
+	rateLimitRejectedBy     = expvar.NewMap("rate_limit_rejected_by")
+)
+
+// rateLimitScript counts a request in a fixed window.
+// KEYS: rate_limit:<route>:<ip|user>:<id>
+// ARGV: window (ms)
+// Returns {count, ttlMs}.
+var rateLimitScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// RateLimiter enforces the per-route budgets in core.RouteRateLimits
+type RateLimiter struct {
+	RDB *redis.Client
+	// TrustProxy takes the client IP from X-Real-IP/X-Forwarded-For, as set by the nginx proxy
+	TrustProxy bool
+	// Limits overrides budgets by route, as configured through RATE_LIMITS
+	Limits map[string]core.RateLimit
+}
+
+func NewRateLimiter(rdb *redis.Client, trustProxy bool, limits map[string]core.RateLimit) *RateLimiter {
+	return &RateLimiter{RDB: rdb, TrustProxy: trustProxy, Limits: limits}
+}
+
+// clientIP returns the address the request came from
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	if l.TrustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allow counts the request against key's budget. Redis errors let the request through.
+func (l *RateLimiter) allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration) {
+	res, err := rateLimitScript.Run(ctx, l.RDB, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return true, 0
+	}
+	if res[0] <= limit {
+		return true, 0
+	}
+	return false, time.Duration(res[1]) * time.Millisecond
+}
+
+// writeRateLimited responds 429 with Retry-After in whole seconds
+func writeRateLimited(w http.ResponseWriter, route string, by string, retry time.Duration) {
+	rateLimitRejectedRoutes.Add(route, 1)
+	rateLimitRejectedBy.Add(by, 1)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.FormatInt(int64((retry+time.Second-1)/time.Second), 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": "rate limit exceeded", "retry_after_ms": retry.Milliseconds()})
+}
+
+// LimitByIP applies the route's budget per client IP. It runs before
+// authentication so unauthenticated floods are turned away cheaply.
+func (l *RateLimiter) LimitByIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		limit := core.RateLimitFor(route, l.Limits)
+		ok, retry := l.allow(r.Context(), "rate_limit:"+route+":ip:"+l.clientIP(r), limit.Requests*core.RateLimitIPMultiplier, limit.Window)
+		if !ok {
+			writeRateLimited(w, route, "ip", retry)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// LimitByUser applies the route's budget per authenticated user. It must run
+// behind Auth.Middleware; anonymous requests pass through.
+func (l *RateLimiter) LimitByUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := SessionFromContext(r.Context())
+		if !ok {
+			next(w, r)
+			return
+		}
+		route := r.URL.Path
+		limit := core.RateLimitFor(route, l.Limits)
+		if ok, retry := l.allow(r.Context(), "rate_limit:"+route+":user:"+session.UserID, limit.Requests, limit.Window); !ok {
+			writeRateLimited(w, route, "user", retry)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Referrals struct {
+	RDB  *redis.Client
+	Auth *Auth
+	Prod *Producers
+}
+
+func NewReferrals(rdb *redis.Client, auth *Auth, prod *Producers) *Referrals {
+	return &Referrals{RDB: rdb, Auth: auth, Prod: prod}
+}
+
+// Attribute links a brand new user to the referrer named in their start_param.
+// Self-referrals, unknown referrers and links that would form a cycle are ignored.
+func (rf *Referrals) Attribute(ctx context.Context, userID string, startParam string) bool {
+	referrerID, ok := core.ParseReferralStartParam(startParam)
+	if !ok || referrerID == userID {
+		return false
+	}
+	exists, err := rf.RDB.Exists(ctx, referrerID).Result()
+	if err != nil || exists == 0 {
+		return false
+	}
+	// Walk up the referrer's chain; finding the new user there would close a cycle
+	current := referrerID
+	for i := 0; i < core.ReferralMaxChainDepth; i++ {
+		parent, err := rf.RDB.Get(ctx, "referrer:"+current).Result()
+		if err != nil {
+			break
+		}
+		if parent == userID {
+			return false
+		}
+		current = parent
+	}
+	set, err := rf.RDB.SetNX(ctx, "referrer:"+userID, referrerID, 0).Result()
+	if err != nil || !set {
+		return false
+	}
+	rf.RDB.ZAdd(ctx, "referrals:"+referrerID, redis.Z{Score: float64(time.Now().Unix()), Member: userID})
+	return true
+}
+
+// CheckMilestones rewards an invitee and their referrer for every milestone the
+// invitee's production rate has reached. Each milestone pays out once.
+func (rf *Referrals) CheckMilestones(userID string, production int) {
+	ctx := context.Background()
+	referrerID, err := rf.RDB.Get(ctx, "referrer:"+userID).Result()
+	if err != nil {
+		return
+	}
+	reached, err := rf.RDB.HLen(ctx, "referral_milestones:"+userID).Result()
+	if err != nil || int(reached) >= len(core.ReferralMilestones) {
+		return
+	}
+	now := time.Now().Unix()
+	for _, m := range core.ReferralMilestones {
+		if production < m.ProductionRate {
+			break
+		}
+		claimed, err := rf.RDB.HSetNX(ctx, "referral_milestones:"+userID, strconv.Itoa(m.ID), now).Result()
+		if err != nil || !claimed {
+			continue
+		}
+		CreditScore(ctx, rf.RDB, userID, m.InviteeReward)
+		CreditScore(ctx, rf.RDB, referrerID, m.InviterReward)
+		rf.RDB.HIncrBy(ctx, "referral_rewards:"+referrerID, userID, m.InviterReward)
+	}
+}
+
+// HandleGetReferrals returns the caller's referral code and their invitees' progress
+func (rf *Referrals) HandleGetReferrals(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	invitees, err := rf.RDB.ZRangeWithScores(ctx, "referrals:"+userID, 0, -1).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	rewards, _ := rf.RDB.HGetAll(ctx, "referral_rewards:"+userID).Result()
+	type Referral struct {
+		UserID            string `json:"user_id"`
+		JoinedAt          int64  `json:"joined_at"`
+		ProductionRate    int    `json:"production_rate"`
+		MilestonesReached int    `json:"milestones_reached"`
+		NextMilestone     *core.ReferralMilestone `json:"next_milestone"`
+		RewardEarned      int64  `json:"reward_earned"`
+	}
+	out := make([]Referral, 0, len(invitees))
+	var totalRewards int64
+	for _, z := range invitees {
+		uid := z.Member.(string)
+		rate, _ := rf.Prod.GetTotalProduction(uid)
+		reached, _ := rf.RDB.HLen(ctx, "referral_milestones:"+uid).Result()
+		earned, _ := strconv.ParseInt(rewards[uid], 10, 64)
+		totalRewards += earned
+		var next *core.ReferralMilestone
+		if int(reached) < len(core.ReferralMilestones) {
+			next = &core.ReferralMilestones[reached]
+		}
+		out = append(out, Referral{
+			UserID:            core.MaskTelegramID(uid),
+			JoinedAt:          int64(z.Score),
+			ProductionRate:    rate,
+			MilestonesReached: int(reached),
+			NextMilestone:     next,
+			RewardEarned:      earned,
+		})
+	}
+	referrer, _ := rf.RDB.Get(ctx, "referrer:"+userID).Result()
+	if referrer != "" {
+		referrer = core.MaskTelegramID(referrer)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code": core.ReferralCode(userID),
+		"referred_by": referrer,
+		"referrals": out,
+		"total_rewards": totalRewards,
+		"milestones": core.ReferralMilestones,
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// spendScoreScript deducts ARGV[1] from the score at KEYS[1] only when the
+// balance covers it, and mirrors the new score into the leaderboard (KEYS[2]).
+// Returns {1, newScore} on success or {0, currentScore} when short.
+var spendScoreScript = redis.NewScript(`
+local score = tonumber(redis.call('GET', KEYS[1]) or '0')
+local amount = tonumber(ARGV[1])
+if score < amount then
+	return {0, score}
+end
+local newScore = redis.call('DECRBY', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[2], newScore, KEYS[1])
+return {1, newScore}
+`)
+
+// creditScoreScript adds ARGV[1] to the score at KEYS[1] and mirrors the new
+// score into the leaderboard (KEYS[2]). Credits are tallied in
+// score_credits:<uid> so anomaly detection can tell them from clicks and production.
+var creditScoreScript = redis.NewScript(`
+local newScore = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('INCRBY', 'score_credits:' .. KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[2], newScore, KEYS[1])
+return newScore
+`)
+
+// SpendScore atomically deducts amount from the user's score if they can afford it.
+// ok is false (and the score untouched) when the balance is insufficient.
+func SpendScore(ctx context.Context, rdb *redis.Client, userID string, amount int64) (int64, bool, error) {
+	res, err := spendScoreScript.Run(ctx, rdb, []string{userID, "leaderboard"}, amount).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return res[1], res[0] == 1, nil
+}
+
+// CreditScore atomically adds amount to the user's score and updates the leaderboard
+func CreditScore(ctx context.Context, rdb *redis.Client, userID string, amount int64) (int64, error) {
+	return creditScoreScript.Run(ctx, rdb, []string{userID, "leaderboard"}, amount).Int64()
+}
+
+// produceScoreScript adds ARGV[1] of producer output to the score at KEYS[1]
+// and mirrors it into the leaderboard (KEYS[2]). Users whose score key has
+// expired are left alone. Returns the new score, or -1 when skipped.
+var produceScoreScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return -1 end
+local newScore = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[2], newScore, KEYS[1])
+return newScore
+`)
+
+// AddProduction atomically adds a tick of producer output to the user's score.
+// ok is false when the user no longer has a score to add to.
+func AddProduction(ctx context.Context, rdb *redis.Client, userID string, amount int64) (int64, bool, error) {
+	score, err := produceScoreScript.Run(ctx, rdb, []string{userID, "leaderboard"}, amount).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	return score, score >= 0, nil
+}
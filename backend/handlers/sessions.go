@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Sessions struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewSessions(rdb *redis.Client, auth *Auth) *Sessions { return &Sessions{RDB: rdb, Auth: auth} }
+
+// HandleList returns the caller's active sessions, marking the one in use
+func (s *Sessions) HandleList(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	stored := s.Auth.userSessions(context.Background(), session.UserID)
+	out := make([]map[string]interface{}, 0, len(stored))
+	for _, st := range stored {
+		out = append(out, map[string]interface{}{
+			"id": st.Session.ID,
+			"device": st.Session.Device,
+			"created_at": st.Session.CreatedAt,
+			"expires_at": st.Session.ExpiresAt,
+			"current": st.Session.ID == session.ID,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sessions": out})
+}
+
+// HandleRefresh rotates the caller's session token, or issues this device's
+// session when authenticating with Telegram init data. The token is returned
+// in the X-Session-ID header as well as the body.
+func (s *Sessions) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var token string
+	var err error
+	if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+		token, err = s.Auth.RotateSession(strings.TrimPrefix(bearer, "Bearer "))
+	} else {
+		token, err = s.Auth.SessionForDevice(session.UserID, session.TelegramUser, session.Device)
+	}
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	w.Header().Set("X-Session-ID", token)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "session_id": token})
+}
+
+// HandleRevoke ends one of the caller's sessions by ID
+func (s *Sessions) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { ID string `json:"id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" { http.Error(w, "bad request", http.StatusBadRequest); return }
+	if !s.Auth.RevokeSession(session.UserID, req.ID) { http.Error(w, "not found", http.StatusNotFound); return }
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// HandleLogout ends the session the request was made with
+func (s *Sessions) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+		s.Auth.revoke(context.Background(), session.UserID, session.ID, strings.TrimPrefix(bearer, "Bearer "))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// HandleLogoutAll ends every session of the caller, on all devices
+func (s *Sessions) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	revoked := s.Auth.RevokeAllSessions(session.UserID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "revoked": revoked})
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	core "neon-clicker/core"
+	"github.com/redis/go-redis/v9"
+)
+
+type Tournaments struct {
+	RDB  *redis.Client
+	Auth *Auth
+}
+
+func NewTournaments(rdb *redis.Client, auth *Auth) *Tournaments {
+	return &Tournaments{RDB: rdb, Auth: auth}
+}
+
+// registerTournamentScript charges the entry fee, adds it to the prize pool and
+// enters the player with a zero score.
+// KEYS: user, leaderboard, tournament_players:<id>, tournament:<id>
+// ARGV: entry fee, base prize
+// Returns {1, newScore}, or {-1,0} already registered, {-2,score} insufficient score.
+var registerTournamentScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[3], KEYS[1]) then return {-1, 0} end
+local fee = tonumber(ARGV[1])
+local score = tonumber(redis.call('GET', KEYS[1]) or '0')
+if score < fee then return {-2, score} end
+local newScore = score
+if fee > 0 then
+	newScore = redis.call('DECRBY', KEYS[1], ARGV[1])
+	redis.call('ZADD', KEYS[2], newScore, KEYS[1])
+end
+redis.call('ZADD', KEYS[3], 0, KEYS[1])
+redis.call('HSETNX', KEYS[4], 'pool', ARGV[2])
+redis.call('HINCRBY', KEYS[4], 'pool', ARGV[1])
+return {1, newScore}
+`)
+
+// prizePool returns the tournament's pool, which starts at the schedule's base prize
+func (t *Tournaments) prizePool(ctx context.Context, tour core.Tournament) int64 {
+	pool, err := t.RDB.HGet(ctx, "tournament:"+tour.ID, "pool").Int64()
+	if err != nil {
+		if s := core.FindTournamentSchedule(tour.ScheduleID); s != nil {
+			return s.BasePrize
+		}
+		return 0
+	}
+	return pool
+}
+
+// record adds amount to the user's score in every running tournament for the
+// metric they are registered in
+func (t *Tournaments) record(metric string, userID string, amount int64) {
+	if amount <= 0 {
+		return
+	}
+	ctx := context.Background()
+	now := time.Now()
+	for _, s := range core.TournamentSchedules {
+		if s.Metric != metric {
+			continue
+		}
+		tour := s.Current(now)
+		if tour.Status(now) != core.TournamentStatusRunning {
+			continue
+		}
+		// XX: only players who registered are counted
+		t.RDB.ZAddArgsIncr(ctx, "tournament_players:"+tour.ID, redis.ZAddArgs{
+			XX:      true,
+			Members: []redis.Z{{Score: float64(amount), Member: userID}},
+		})
+	}
+}
+
+// RecordClicks feeds taps into running click tournaments
+func (t *Tournaments) RecordClicks(userID string, clicks int64) {
+	t.record(core.TournamentMetricClicks, userID, clicks)
+}
+
+// RecordProduction feeds produced score into running production tournaments
+func (t *Tournaments) RecordProduction(userID string, produced int64) {
+	t.record(core.TournamentMetricProduction, userID, produced)
+}
+
+// tournamentPayoutScript pays one player's prize and records their placement
+// and stats, once per tournament: tournament_paid:<id> remembers who was paid.
+// KEYS: tournament_paid:<id>, user, leaderboard, tournament_results:<uid>, tournament_stats:<uid>
+// ARGV: prize, placement JSON, results size, paid marker TTL (s), won (0/1), podium (0/1)
+// Returns 1 when paid now, 0 when already paid.
+var tournamentPayoutScript = redis.NewScript(`
+if redis.call('SADD', KEYS[1], KEYS[2]) == 0 then return 0 end
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+if tonumber(ARGV[1]) > 0 then
+	local score = redis.call('INCRBY', KEYS[2], ARGV[1])
+	redis.call('INCRBY', 'score_credits:' .. KEYS[2], ARGV[1])
+	redis.call('ZADD', KEYS[3], score, KEYS[2])
+end
+redis.call('LPUSH', KEYS[4], ARGV[2])
+redis.call('LTRIM', KEYS[4], 0, tonumber(ARGV[3]) - 1)
+redis.call('HINCRBY', KEYS[5], 'played', 1)
+redis.call('HINCRBY', KEYS[5], 'prizes', ARGV[1])
+if ARGV[5] == '1' then redis.call('HINCRBY', KEYS[5], 'wins', 1) end
+if ARGV[6] == '1' then redis.call('HINCRBY', KEYS[5], 'podiums', 1) end
+return 1
+`)
+
+// finalize pays out a finished tournament and records every participant's
+// placement. Each player is paid at most once, so an interrupted run can simply
+// be repeated; the tournament is marked finalized only once everyone is paid.
+// It reports whether the tournament was finalized.
+func (t *Tournaments) finalize(ctx context.Context, tour core.Tournament) bool {
+	playersKey := "tournament_players:" + tour.ID
+	players, err := t.RDB.ZRevRangeWithScores(ctx, playersKey, 0, -1).Result()
+	if err != nil {
+		return false
+	}
+	pool := t.prizePool(ctx, tour)
+	// Players hidden from leaderboards cannot place: the rest are ranked as if
+	// they were absent, and a hidden player is told the place they would see
+	excluded, _ := t.RDB.SMembers(ctx, "leaderboard_excluded").Result()
+	hidden := make(map[string]bool, len(excluded))
+	for _, uid := range excluded {
+		hidden[uid] = true
+	}
+	retention := int64(core.TournamentDataRetention / time.Second)
+	visiblePlaces := 0
+	for _, z := range players {
+		uid := z.Member.(string)
+		place := visiblePlaces + 1
+		if !hidden[uid] {
+			visiblePlaces++
+		}
+		// Players who never scored cannot place in the prizes
+		placed := z.Score > 0 && !hidden[uid]
+		prize := int64(0)
+		if placed {
+			prize = core.TournamentPrize(pool, tour.PrizeSplit, place)
+		}
+		placement, _ := json.Marshal(core.TournamentPlacement{
+			TournamentID: tour.ID,
+			Name:         tour.Name,
+			Place:        place,
+			Score:        int64(z.Score),
+			Prize:        prize,
+			EndedAt:      tour.EndsAt,
+		})
+		won, podium := 0, 0
+		if placed && place == 1 {
+			won = 1
+		}
+		if placed && place <= 3 {
+			podium = 1
+		}
+		keys := []string{"tournament_paid:" + tour.ID, uid, "leaderboard", "tournament_results:" + uid, "tournament_stats:" + uid}
+		if err := tournamentPayoutScript.Run(ctx, t.RDB, keys, prize, placement, core.TournamentResultsSize, retention, won, podium).Err(); err != nil {
+			return false
+		}
+	}
+	t.RDB.Expire(ctx, playersKey, core.TournamentDataRetention)
+	t.RDB.Expire(ctx, "tournament:"+tour.ID, core.TournamentDataRetention)
+	return t.RDB.Set(ctx, "tournament_finalized:"+tour.ID, time.Now().Unix(), core.TournamentDataRetention).Err() == nil
+}
+
+// Sweep finalizes every finished instance of each schedule, oldest first,
+// catching up on instances that ended while the server was down. At most
+// TournamentFinalizeBatch instances are finalized per call; the rest wait for
+// the next sweep. Instances older than TournamentDataRetention are given up on.
+func (t *Tournaments) Sweep() {
+	ctx := context.Background()
+	now := time.Now()
+	oldest := now.Add(-core.TournamentDataRetention).Unix()
+	budget := core.TournamentFinalizeBatch
+	for _, s := range core.TournamentSchedules {
+		if budget == 0 {
+			return
+		}
+		var instances []core.Tournament
+		for tour := s.Previous(now); tour.EndsAt > oldest; tour = s.Before(tour) {
+			instances = append(instances, tour)
+		}
+		pipe := t.RDB.Pipeline()
+		done := make([]*redis.IntCmd, len(instances))
+		for i, tour := range instances {
+			done[i] = pipe.Exists(ctx, "tournament_finalized:"+tour.ID)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			continue
+		}
+		// Instances are finalized in order, so the newest finalized one ends the backlog
+		pending := len(instances)
+		for i := range instances {
+			if done[i].Val() == 1 {
+				pending = i
+				break
+			}
+		}
+		for i := pending - 1; i >= 0 && budget > 0; i-- {
+			if !t.finalize(ctx, instances[i]) {
+				break
+			}
+			budget--
+		}
+	}
+}
+
+// view summarizes a tournament as seen by userID
+func (t *Tournaments) view(ctx context.Context, tour core.Tournament, userID string) map[string]interface{} {
+	playersKey := "tournament_players:" + tour.ID
+	visibleKey := visibleBoard(ctx, t.RDB, playersKey, userID)
+	participants, _ := t.RDB.ZCard(ctx, visibleKey).Result()
+	out := map[string]interface{}{
+		"tournament": tour,
+		"status": tour.Status(time.Now()),
+		"prize_pool": t.prizePool(ctx, tour),
+		"participants": participants,
+		"registered": false,
+	}
+	if score, err := t.RDB.ZScore(ctx, playersKey, userID).Result(); err == nil {
+		out["registered"] = true
+		out["my_score"] = int64(score)
+		// Ranked on the same visible board as the standings
+		if rank, err := t.RDB.ZRevRank(ctx, visibleKey, userID).Result(); err == nil {
+			out["my_rank"] = rank + 1
+		}
+	}
+	return out
+}
+
+// HandleList returns the current or next instance of every scheduled tournament
+func (t *Tournaments) HandleList(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	now := time.Now()
+	out := make([]map[string]interface{}, 0, len(core.TournamentSchedules))
+	for _, s := range core.TournamentSchedules {
+		out = append(out, t.view(ctx, s.Current(now), session.UserID))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleGet returns a tournament with its top standings
+func (t *Tournaments) HandleGet(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	tour, ok := core.ParseTournamentID(r.URL.Query().Get("id"))
+	if !ok { http.Error(w, "not found", http.StatusNotFound); return }
+	ctx := context.Background()
+	currentUserID := session.UserID
+	results, err := t.RDB.ZRevRangeWithScores(ctx, visibleBoard(ctx, t.RDB, "tournament_players:"+tour.ID, currentUserID), 0, core.TournamentStandingsSize-1).Result()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	pool := t.prizePool(ctx, *tour)
+	ids := make([]string, len(results))
+	for i, z := range results {
+		ids[i] = z.Member.(string)
+	}
+	names := displayNames(ctx, t.RDB, ids)
+	standings := make([]map[string]interface{}, len(results))
+	for i, z := range results {
+		userID := z.Member.(string)
+		standings[i] = map[string]interface{}{
+			"user_id": core.MaskTelegramID(userID),
+			"display_name": publicName(names, userID),
+			"score": int64(z.Score),
+			"prize": core.TournamentPrize(pool, tour.PrizeSplit, i+1),
+			"is_self": userID == currentUserID,
+		}
+	}
+	out := t.view(ctx, *tour, currentUserID)
+	out["standings"] = standings
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleRegister enters the caller into a tournament during its registration window
+func (t *Tournaments) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var req struct { TournamentID string `json:"tournament_id"` }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	tour, ok := core.ParseTournamentID(req.TournamentID)
+	if !ok { http.Error(w, "not found", http.StatusNotFound); return }
+	if tour.Status(time.Now()) != core.TournamentStatusRegistration {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "registration is closed"})
+		return
+	}
+	ctx := context.Background()
+	userID := session.UserID
+	s := core.FindTournamentSchedule(tour.ScheduleID)
+	keys := []string{userID, "leaderboard", "tournament_players:" + tour.ID, "tournament:" + tour.ID}
+	res, err := registerTournamentScript.Run(ctx, t.RDB, keys, tour.EntryFee, s.BasePrize).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "already registered"})
+		return
+	case -2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "insufficient score", "score": res[1]})
+		return
+	}
+	out := t.view(ctx, *tour, userID)
+	out["success"] = true
+	out["score"] = res[1]
+	json.NewEncoder(w).Encode(out)
+}
+
+// HandleResults returns the caller's tournament placements and totals
+func (t *Tournaments) HandleResults(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	ctx := context.Background()
+	userID := session.UserID
+	raw, _ := t.RDB.LRange(ctx, "tournament_results:"+userID, 0, core.TournamentResultsSize-1).Result()
+	placements := make([]core.TournamentPlacement, 0, len(raw))
+	for _, item := range raw {
+		var p core.TournamentPlacement
+		if json.Unmarshal([]byte(item), &p) == nil {
+			placements = append(placements, p)
+		}
+	}
+	statsRaw, _ := t.RDB.HGetAll(ctx, "tournament_stats:"+userID).Result()
+	stats := map[string]int64{"played": 0, "wins": 0, "podiums": 0, "prizes": 0}
+	for k, v := range statsRaw {
+		stats[k], _ = strconv.ParseInt(v, 10, 64)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"placements": placements,
+		"stats": stats,
+	})
+}
@@ -10,21 +10,82 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// clickBatchScript applies a batch of taps at the caller's current power.
+// Batches are refused when their sequence number was already seen, their
+// window overlaps the last batch, the user is throttled, or they hold more
+// taps than ARGV[9] per second allows. The allowance covers the batch's window,
+// stretched to at most one second by idle time since the previous batch, so
+// short windows are prorated. Accepted taps are charged to the click bucket;
+// taps beyond what it holds are dropped.
+// KEYS: user, power:<uid>, clicks:<uid>, leaderboard, clicks_leaderboard, click_batch:<uid>, user_created:<uid>,
+//       click_bucket:<uid>, click_throttled:<uid>
+// ARGV: seq, taps, started_at, ended_at, initial score, now, user data TTL (s), batch state TTL (s),
+//       max taps per second, bucket capacity, refill per second, throttled percent, now (ms)
+// Returns {1, score, clicks, power, accepted}, or {-1, lastSeq} replayed sequence, {-2, lastSeq} overlapping
+// window, {-3, lastSeq} implausible tap count, {-4, lastSeq, retryMs} throttled, {-5, lastSeq, retryMs} bucket empty.
+var clickBatchScript = redis.NewScript(clickBucketLua + `
+local last = redis.call('HMGET', KEYS[6], 'seq', 'ended_at')
+local lastSeq = tonumber(last[1]) or 0
+local lastEnd = tonumber(last[2]) or 0
+local taps = tonumber(ARGV[2])
+local startedAt, endedAt = tonumber(ARGV[3]), tonumber(ARGV[4])
+if tonumber(ARGV[1]) <= lastSeq then return {-1, lastSeq} end
+if startedAt < lastEnd then return {-2, lastSeq} end
+local throttle = redis.call('PTTL', KEYS[9])
+if throttle > 0 then return {-4, lastSeq, throttle} end
+local window = endedAt - startedAt
+local minWindow = math.min(1000, endedAt - lastEnd)
+if window < minWindow then window = minWindow end
+if taps * 1000 > tonumber(ARGV[9]) * window then return {-3, lastSeq} end
+local capacity = tonumber(ARGV[10])
+local tokens, rate = refillClickBucket(KEYS[8], KEYS[9], capacity, tonumber(ARGV[11]), tonumber(ARGV[12]), tonumber(ARGV[13]))
+local accepted = math.min(taps, math.floor(tokens))
+if accepted < 1 then
+	saveClickBucket(KEYS[8], tokens, ARGV[13], capacity, rate)
+	return {-5, lastSeq, math.ceil((1 - tokens) * 1000 / rate)}
+end
+saveClickBucket(KEYS[8], tokens - accepted, ARGV[13], capacity, rate)
+local power = tonumber(redis.call('GET', KEYS[2]) or '1')
+local earned = power * accepted
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	earned = earned + tonumber(ARGV[5])
+	redis.call('SETNX', KEYS[7], ARGV[6])
+end
+local score = redis.call('INCRBY', KEYS[1], string.format('%d', earned))
+local clicks = redis.call('INCRBY', KEYS[3], string.format('%d', accepted))
+redis.call('ZADD', KEYS[4], score, KEYS[1])
+redis.call('ZADD', KEYS[5], clicks, KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[7])
+redis.call('EXPIRE', KEYS[3], ARGV[7])
+redis.call('HSET', KEYS[6], 'seq', ARGV[1], 'ended_at', ARGV[4])
+redis.call('EXPIRE', KEYS[6], ARGV[8])
+return {1, score, clicks, power, accepted}
+`)
+
+// setPowerScript moves the user's power from ARGV[1] to ARGV[2], refusing when
+// a concurrent upgrade already changed it.
+// KEYS: power:<uid>, power_price:<uid>
+// ARGV: expected power, new power, new price
+// Returns 1 when applied, 0 when the power changed meanwhile.
+var setPowerScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '1') ~= tonumber(ARGV[1]) then return 0 end
+redis.call('SET', KEYS[1], ARGV[2])
+redis.call('SET', KEYS[2], ARGV[3])
+return 1
+`)
+
 type Upgrades struct {
-	RDB  *redis.Client
-	Auth *Auth
+	RDB         *redis.Client
+	Auth        *Auth
+	Tournaments *Tournaments
 }
 
-func NewUpgrades(rdb *redis.Client, auth *Auth) *Upgrades {
-	return &Upgrades{RDB: rdb, Auth: auth}
+func NewUpgrades(rdb *redis.Client, auth *Auth, tournaments *Tournaments) *Upgrades {
+	return &Upgrades{RDB: rdb, Auth: auth, Tournaments: tournaments}
 }
 
 func (u *Upgrades) HandleGetUpgrades(w http.ResponseWriter, r *http.Request) {
-	session, err := u.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
+	session := CurrentSession(r)
 	ctx := context.Background()
 	user := session.UserID
 	score, _ := u.rdb().Get(ctx, user).Int()
@@ -49,11 +110,7 @@ func (u *Upgrades) HandleGetUpgrades(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u *Upgrades) HandleUpgradePower(w http.ResponseWriter, r *http.Request) {
-	session, err := u.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
+	session := CurrentSession(r)
 	ctx := context.Background()
 	user := session.UserID
 	score, _ := u.rdb().Get(ctx, user).Int()
@@ -87,14 +144,34 @@ func (u *Upgrades) HandleUpgradePower(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	buildTime := 0
-	newScore := score - price
-	u.rdb().Set(ctx, user, newScore, 0)
-	u.rdb().ZAdd(ctx, "leaderboard", redis.Z{Score: float64(newScore), Member: user})
+	newScore, ok, err := SpendScore(ctx, u.rdb(), user, int64(price))
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	if !ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "insufficient score",
+			"power": power,
+			"price": price,
+			"score": newScore,
+		})
+		return
+	}
 	if buildTime == 0 {
 		newPower := core.CalculateNextPower(power)
 		newPrice := core.CalculateNextPowerPrice(newPower)
-		u.rdb().Set(ctx, "power:"+user, newPower, 0)
-		u.rdb().Set(ctx, "power_price:"+user, newPrice, 0)
+		applied, err := setPowerScript.Run(ctx, u.rdb(), []string{"power:" + user, "power_price:" + user}, power, newPower, newPrice).Int()
+		if err != nil || applied == 0 {
+			// Another upgrade got there first: give the price back
+			newScore, _ = CreditScore(ctx, u.rdb(), user, int64(price))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "upgrade already in progress",
+				"power": power,
+				"price": price,
+				"score": newScore,
+			})
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": true,
 			"power": newPower,
@@ -120,13 +197,13 @@ func (u *Upgrades) HandleUpgradePower(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u *Upgrades) HandleClick(w http.ResponseWriter, r *http.Request) {
-	session, err := u.Auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
+	session := CurrentSession(r)
 	ctx := context.Background()
 	userID := session.UserID
+	if ok, retry := takeClickTokens(ctx, u.rdb(), userID, 1); !ok {
+		writeClickThrottled(w, retry)
+		return
+	}
 	power, errP := u.rdb().Get(ctx, "power:"+userID).Int()
 	if errP != nil { power = 1 }
 	exists, err := u.rdb().Exists(ctx, userID).Result()
@@ -134,6 +211,7 @@ func (u *Upgrades) HandleClick(w http.ResponseWriter, r *http.Request) {
 	var score int64
 	if exists == 0 {
 		score, err = u.rdb().IncrBy(ctx, userID, int64(core.InitialScore+power)).Result()
+		u.rdb().SetNX(ctx, "user_created:"+userID, time.Now().Unix(), 0)
 	} else {
 		score, err = u.rdb().IncrBy(ctx, userID, int64(power)).Result()
 	}
@@ -144,7 +222,71 @@ func (u *Upgrades) HandleClick(w http.ResponseWriter, r *http.Request) {
 	u.rdb().ZAdd(ctx, "clicks_leaderboard", redis.Z{Score: float64(clicks), Member: userID})
 	u.rdb().Expire(ctx, userID, core.UserDataTTL)
 	u.rdb().Expire(ctx, "clicks:"+userID, core.UserDataTTL)
+	u.Tournaments.RecordClicks(userID, 1)
+	RecordWindowed(ctx, u.rdb(), core.LeaderboardBoardEarned, userID, int64(power))
+	RecordWindowed(ctx, u.rdb(), core.LeaderboardBoardClicks, userID, 1)
+	recordClickTimes(ctx, u.rdb(), userID, []int64{time.Now().UnixMilli()}, clicks)
 	json.NewEncoder(w).Encode(map[string]int{"score": int(score), "power": power, "clicks": int(clicks)})
 }
 
+// HandleClickBatch applies a batch of taps in one atomic update. Batches must
+// be plausible for a human, carry increasing sequence numbers and cover
+// non-overlapping windows, so a resent batch is never counted twice. They
+// share the click token bucket, throttling and regularity checks with
+// HandleClick.
+func (u *Upgrades) HandleClickBatch(w http.ResponseWriter, r *http.Request) {
+	session := CurrentSession(r)
+	var batch core.ClickBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil { http.Error(w, "bad request", http.StatusBadRequest); return }
+	ctx := context.Background()
+	userID := session.UserID
+	now := time.Now()
+	if msg := core.ValidateClickBatch(batch, now); msg != "" {
+		score, _ := u.rdb().Get(ctx, userID).Int64()
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": msg, "score": score})
+		return
+	}
+	keys := []string{userID, "power:" + userID, "clicks:" + userID, "leaderboard", "clicks_leaderboard", "click_batch:" + userID, "user_created:" + userID,
+		"click_bucket:" + userID, "click_throttled:" + userID}
+	res, err := clickBatchScript.Run(ctx, u.rdb(), keys,
+		batch.Seq, batch.Taps, batch.StartedAt, batch.EndedAt, core.InitialScore, now.Unix(),
+		int64(core.UserDataTTL/time.Second), int64(core.ClickBatchStateTTL/time.Second),
+		core.ClickBatchMaxTapsPerSecond, core.ClickBucketCapacity, core.ClickRefillPerSecond, core.ClickThrottledPercent, now.UnixMilli()).Int64Slice()
+	if err != nil { http.Error(w, "redis error", http.StatusInternalServerError); return }
+	switch res[0] {
+	case -4, -5:
+		countClickRejects(ctx, u.rdb(), userID, batch.Taps)
+		writeClickThrottled(w, time.Duration(res[2])*time.Millisecond)
+		return
+	case -1, -2, -3:
+		msg := "batch already applied"
+		switch res[0] {
+		case -2:
+			msg = "batch window overlaps previous batch"
+		case -3:
+			msg = "too many taps for time window"
+			addClickStrike(ctx, u.rdb(), userID, core.ClickStrikeRateLimit)
+		}
+		score, _ := u.rdb().Get(ctx, userID).Int64()
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": msg, "score": score, "last_seq": res[1]})
+		return
+	}
+	score, clicks, power, accepted := res[1], res[2], res[3], res[4]
+	if dropped := batch.Taps - accepted; dropped > 0 {
+		countClickRejects(ctx, u.rdb(), userID, dropped)
+	}
+	recordClickTimes(ctx, u.rdb(), userID, batch.TapTimes(accepted), clicks)
+	u.Tournaments.RecordClicks(userID, accepted)
+	RecordWindowed(ctx, u.rdb(), core.LeaderboardBoardEarned, userID, power*accepted)
+	RecordWindowed(ctx, u.rdb(), core.LeaderboardBoardClicks, userID, accepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"score": score,
+		"power": power,
+		"clicks": clicks,
+		"accepted": accepted,
+		"seq": batch.Seq,
+	})
+}
+
 func (u *Upgrades) rdb() *redis.Client { return u.RDB }
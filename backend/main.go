@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	app "neon-clicker/app"
 	core "neon-clicker/core"
 	handlers "neon-clicker/handlers"
 )
@@ -22,57 +23,20 @@ type Server struct {
 	botToken string
 	auth *handlers.Auth
 	prod *handlers.Producers
+	ref *handlers.Referrals
+	tour *handlers.Tournaments
 }
 
-func NewServer(addr string) *Server {
-	rdb := redis.NewClient(&redis.Options{
-		Addr: addr,
-	})
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	a := handlers.NewAuth(rdb, botToken)
-	return &Server{rdb: rdb, botToken: botToken, auth: a}
-}
-
-func (s *Server) handleGetState(w http.ResponseWriter, r *http.Request) {
-	session, err := s.auth.AuthenticateRequest(r)
-	if err != nil {
-		http.Error(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
-	
-	user := session.UserID
-	
-	// Check if this is a new user (no score exists)
-	exists, err := s.rdb.Exists(ctx, user).Result()
-	if err != nil {
-		http.Error(w, "redis error", 500)
-		return
+func NewServer(cfg app.Config) *Server {
+	rdb := app.NewRedis(cfg.RedisAddr)
+	providers := []handlers.AuthProvider{handlers.NewTelegramProvider(cfg.BotToken)}
+	if cfg.DevAuth {
+		log.Println("WARNING: dev auth enabled; any client can act as any user")
+		providers = append(providers, handlers.NewDevProvider())
 	}
-	
-	var score int
-	if exists == 0 {
-		// New user - return 10000 initial score
-		score = 10000
-		// Persist initial score so other endpoints (e.g., buy_producer) see it
-		s.rdb.Set(ctx, user, score, 0)
-		// Seed leaderboard with initial score
-		s.rdb.ZAdd(ctx, "leaderboard", redis.Z{Score: float64(score), Member: user})
-	} else {
-		// Existing user - get their actual score
-		score, _ = s.rdb.Get(ctx, user).Int()
-	}
-	
-	// Return session ID in header if this was a new session
-	authHeader := r.Header.Get("Authorization")
-	if strings.HasPrefix(authHeader, "tma ") || (user == "1234567" && authHeader == "") {
-		// This was a new session, return the session ID
-		sessionID, err := s.auth.CreateSession(user, session.TelegramUser)
-		if err == nil {
-			w.Header().Set("X-Session-ID", sessionID)
-		}
-	}
-	
-	json.NewEncoder(w).Encode(map[string]int{"score": score})
+	a := handlers.NewAuth(rdb, providers...)
+	a.SetAdmins(strings.Split(os.Getenv("ADMIN_USER_IDS"), ","))
+	return &Server{rdb: rdb, botToken: cfg.BotToken, auth: a}
 }
 
 // handleUpgradePower moved to handlers_upgrades.go
@@ -117,15 +81,15 @@ func (s *Server) startBackgroundProduction() {
 					continue
 				}
 				
-				// Add production to score
-				score, err := s.rdb.Get(ctx, userID).Int()
-				if err != nil {
-					continue
-				}
+				// Reward referral milestones reached by this user
+				s.ref.CheckMilestones(userID, production)
+				
+				// Count production towards running tournaments and windowed leaderboards
+				s.tour.RecordProduction(userID, int64(production))
+				handlers.RecordWindowed(ctx, s.rdb, core.LeaderboardBoardEarned, userID, int64(production))
 				
-				newScore := score + production
-				s.rdb.Set(ctx, userID, newScore, 0)
-				s.rdb.ZAdd(ctx, "leaderboard", redis.Z{Score: float64(newScore), Member: userID})
+				// Add production to score in one step so concurrent spends are never overwritten
+				handlers.AddProduction(ctx, s.rdb, userID, int64(production))
 			}
 		}
 	}()
@@ -175,41 +139,159 @@ func (s *Server) checkAndCompleteProducerBuilds(userID string) {
 			newOwned := owned + 1
 			s.rdb.Set(ctx, "producer:"+userID+":"+strconv.Itoa(producer.ID), newOwned, 0)
 			s.rdb.Del(ctx, "producer_build_end:"+userID+":"+strconv.Itoa(producer.ID)) // Remove build timer
+			handlers.UpdateProductionRate(ctx, s.rdb, userID)
 		}
 	}
 }
 
+// Run a maintenance job in the background at a fixed interval
+func startPeriodic(interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			job()
+		}
+	}()
+}
+
 func main() {
-	addr := os.Getenv("REDIS_ADDR")
-	if addr == "" {
-		addr = "localhost:6379"
+	cfg := app.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
-	s := NewServer(addr)
+	s := NewServer(cfg)
 	p := handlers.NewProducers(s.rdb, s.auth)
-	u := handlers.NewUpgrades(s.rdb, s.auth)
+	t := handlers.NewTournaments(s.rdb, s.auth)
+	u := handlers.NewUpgrades(s.rdb, s.auth, t)
+	ref := handlers.NewReferrals(s.rdb, s.auth, p)
 	st := handlers.NewState(s.rdb, s.auth)
+	// Credit the referrer from the launch start_param on a user's first authentication
+	s.auth.OnNewUser(func(ctx context.Context, session *core.Session) {
+		ref.Attribute(ctx, session.UserID, session.StartParam)
+	})
 	lb := handlers.NewLeaderboard(s.rdb, s.auth, p)
 	d := handlers.NewDonations(s.rdb, s.auth)
+	b := handlers.NewBuffs(s.rdb, s.auth)
+	g := handlers.NewGuilds(s.rdb, s.auth)
+	gf := handlers.NewGifts(s.rdb, s.auth)
+	m := handlers.NewMarket(s.rdb, s.auth)
+	du := handlers.NewDuels(s.rdb, s.auth)
+	fr := handlers.NewFriends(s.rdb, s.auth)
+	rh := handlers.NewRankHistory(s.rdb, s.auth)
+	mod := handlers.NewModeration(s.rdb, s.auth)
+	ss := handlers.NewSessions(s.rdb, s.auth)
+	an := handlers.NewAnomalies(s.rdb, s.auth, p)
+	pr := handlers.NewProfiles(s.rdb, s.auth, strings.Split(os.Getenv("DISPLAY_NAME_BLOCKLIST"), ","))
 	
 	// Attach producers helper to server and start background production
 	s.prod = p
+	s.ref = ref
+	s.tour = t
+	p.RebuildProductionRates()
+	s.auth.BackfillUserCreated()
 	s.startBackgroundProduction()
+	d.InitGoals()
+	// Re-aggregate guild scores, return expired market escrow, settle duels and tournaments,
+	// run donation campaigns, take rank history snapshots and audit score growth
+	startPeriodic(core.GuildLeaderboardRefreshInterval, g.RefreshLeaderboard)
+	startPeriodic(core.MarketExpirySweepInterval, m.ExpireListings)
+	startPeriodic(core.DuelSweepInterval, du.Sweep)
+	startPeriodic(core.TournamentSweepInterval, t.Sweep)
+	startPeriodic(core.DonationGoalSweepInterval, d.SweepGoals)
+	startPeriodic(core.RankSnapshotCheckInterval, rh.Snapshot)
+	startPeriodic(core.ScoreAnomalyScanInterval, an.Scan)
+
+	// Every route is rate limited by client IP, authenticates through the middleware
+	// (handlers read the session from the request context), is rate limited by user
+	// and replays earlier responses for repeated Idempotency-Keys
+	rl := handlers.NewRateLimiter(s.rdb, cfg.TrustProxy, cfg.RateLimits)
+	idem := handlers.NewIdempotency(s.rdb)
+	user := func(h http.HandlerFunc) http.HandlerFunc {
+		return rl.LimitByIP(s.auth.Middleware(handlers.PolicyUser, rl.LimitByUser(idem.Middleware(h))))
+	}
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return rl.LimitByIP(s.auth.Middleware(handlers.PolicyAdmin, rl.LimitByUser(idem.Middleware(h))))
+	}
 
-	http.HandleFunc("/api/state", st.HandleGetState)
-	http.HandleFunc("/api/click", u.HandleClick)
-	http.HandleFunc("/api/leaderboard", lb.HandleLeaderboard)
-	http.HandleFunc("/api/per_second_leaderboard", lb.HandlePerSecond)
-	http.HandleFunc("/api/clicks_leaderboard", lb.HandleClicks)
-	http.HandleFunc("/api/user_upgrades", u.HandleGetUpgrades)
-	http.HandleFunc("/api/upgrade_power", u.HandleUpgradePower)
-	http.HandleFunc("/api/producers", p.HandleGetProducers)
-	http.HandleFunc("/api/buy_producer", p.HandleBuyProducer)
-	http.HandleFunc("/api/production", p.HandleGetProduction)
-	http.HandleFunc("/api/donations/goals", d.HandleListGoals)
-	http.HandleFunc("/api/donations/goal", d.HandleGetGoal)
-	http.HandleFunc("/api/donations/donate", d.HandleDonate)
+	// API routes get their own mux: expvar registers /debug/vars on the default
+	// one, and metrics are only served on the internal listener
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/state", user(st.HandleGetState))
+	mux.HandleFunc("/api/sessions", user(ss.HandleList))
+	mux.HandleFunc("/api/sessions/refresh", user(ss.HandleRefresh))
+	mux.HandleFunc("/api/sessions/revoke", user(ss.HandleRevoke))
+	mux.HandleFunc("/api/logout", user(ss.HandleLogout))
+	mux.HandleFunc("/api/logout_all", user(ss.HandleLogoutAll))
+	mux.HandleFunc("/api/click", user(u.HandleClick))
+	mux.HandleFunc("/api/click/batch", user(u.HandleClickBatch))
+	mux.HandleFunc("/api/leaderboard", user(lb.HandleLeaderboard))
+	mux.HandleFunc("/api/per_second_leaderboard", user(lb.HandlePerSecond))
+	mux.HandleFunc("/api/clicks_leaderboard", user(lb.HandleClicks))
+	mux.HandleFunc("/api/guild_leaderboard", user(lb.HandleGuilds))
+	mux.HandleFunc("/api/rank_history", user(rh.HandleGet))
+	mux.HandleFunc("/api/user_upgrades", user(u.HandleGetUpgrades))
+	mux.HandleFunc("/api/upgrade_power", user(u.HandleUpgradePower))
+	mux.HandleFunc("/api/producers", user(p.HandleGetProducers))
+	mux.HandleFunc("/api/buy_producer", user(p.HandleBuyProducer))
+	mux.HandleFunc("/api/production", user(p.HandleGetProduction))
+	mux.HandleFunc("/api/donations/goals", user(d.HandleListGoals))
+	mux.HandleFunc("/api/donations/goal", user(d.HandleGetGoal))
+	mux.HandleFunc("/api/donations/donate", user(d.HandleDonate))
+	mux.HandleFunc("/api/donations/donors", user(d.HandleDonors))
+	mux.HandleFunc("/api/donations/history", user(d.HandleHistory))
+	mux.HandleFunc("/api/buffs", user(b.HandleList))
+	mux.HandleFunc("/api/admin/donations/goals", admin(d.HandleAdminList))
+	mux.HandleFunc("/api/admin/donations/goal/create", admin(d.HandleAdminCreate))
+	mux.HandleFunc("/api/admin/donations/goal/update", admin(d.HandleAdminUpdate))
+	mux.HandleFunc("/api/admin/donations/goal/close", admin(d.HandleAdminClose))
+	mux.HandleFunc("/api/admin/clicks/flagged", admin(mod.HandleFlagged))
+	mux.HandleFunc("/api/admin/clicks/review", admin(mod.HandleReview))
+	mux.HandleFunc("/api/admin/anomalies", admin(an.HandleList))
+	mux.HandleFunc("/api/admin/anomalies/dismiss", admin(an.HandleDismiss))
+	mux.HandleFunc("/api/admin/shadow_bans", admin(mod.HandleShadowBans))
+	mux.HandleFunc("/api/admin/shadow_ban", admin(mod.HandleShadowBan))
+	mux.HandleFunc("/api/profile", user(pr.HandleGet))
+	mux.HandleFunc("/api/profile/name", user(pr.HandleSetName))
+	mux.HandleFunc("/api/profile/visibility", user(pr.HandleSetVisibility))
+	mux.HandleFunc("/api/profile/country", user(pr.HandleSetCountry))
+	mux.HandleFunc("/api/referrals", user(ref.HandleGetReferrals))
+	mux.HandleFunc("/api/friends", user(fr.HandleList))
+	mux.HandleFunc("/api/friends/add", user(fr.HandleAdd))
+	mux.HandleFunc("/api/friends/remove", user(fr.HandleRemove))
+	mux.HandleFunc("/api/friends/leaderboard", user(fr.HandleLeaderboard))
+	mux.HandleFunc("/api/gift", user(gf.HandleSend))
+	mux.HandleFunc("/api/gifts", user(gf.HandleHistory))
+	mux.HandleFunc("/api/market", user(m.HandleSearch))
+	mux.HandleFunc("/api/market/mine", user(m.HandleMine))
+	mux.HandleFunc("/api/market/list", user(m.HandleList))
+	mux.HandleFunc("/api/market/buy", user(m.HandleBuy))
+	mux.HandleFunc("/api/market/cancel", user(m.HandleCancel))
+	mux.HandleFunc("/api/duels", user(du.HandleListDuels))
+	mux.HandleFunc("/api/duel", user(du.HandleGetDuel))
+	mux.HandleFunc("/api/duel/challenge", user(du.HandleChallenge))
+	mux.HandleFunc("/api/duel/accept", user(du.HandleAccept))
+	mux.HandleFunc("/api/duel/decline", user(du.HandleDecline))
+	mux.HandleFunc("/api/duel/click", user(du.HandleClick))
+	mux.HandleFunc("/api/tournaments", user(t.HandleList))
+	mux.HandleFunc("/api/tournament", user(t.HandleGet))
+	mux.HandleFunc("/api/tournaments/register", user(t.HandleRegister))
+	mux.HandleFunc("/api/tournaments/results", user(t.HandleResults))
+	mux.HandleFunc("/api/guild", user(g.HandleGetGuild))
+	mux.HandleFunc("/api/guild/create", user(g.HandleCreate))
+	mux.HandleFunc("/api/guild/join", user(g.HandleJoin))
+	mux.HandleFunc("/api/guild/leave", user(g.HandleLeave))
+	mux.HandleFunc("/api/guild/kick", user(g.HandleKick))
+	mux.HandleFunc("/api/guild/role", user(g.HandleSetRole))
+	mux.HandleFunc("/api/guild/contribute", user(g.HandleContribute))
+
+	metrics := http.NewServeMux()
+	metrics.Handle("/debug/vars", expvar.Handler())
+	go func() {
+		log.Println("Metrics served on " + cfg.MetricsAddr)
+		log.Fatal(http.ListenAndServe(cfg.MetricsAddr, metrics))
+	}()
 
 	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", mux))
 }
@@ -45,28 +45,7 @@ export default function NeonClickerGame() {
     const forceUserId = (import.meta as any).env?.VITE_FORCE_USER_ID;
     if (forceUserId) {
       tid = forceUserId;
-      
-      // For local development, simulate Telegram init data
-      if (forceUserId === '1234567') {
-        const mockUser = {
-          id: 1234567,
-          first_name: "Test",
-          last_name: "User",
-          username: "testuser",
-          language_code: "en",
-          is_premium: false
-        };
-
-        const mockInitData = new URLSearchParams({
-          user: JSON.stringify(mockUser),
-          auth_date: Math.floor(Date.now() / 1000).toString(),
-          query_id: "test_query_123",
-          hash: "mock_hash_for_local_dev"
-        }).toString();
-        
-        initDataRaw = mockInitData;
-        console.log('🔧 Local dev mode: Using mock Telegram init data');
-      }
+      console.log('🔧 Local dev mode: authenticating as test user', forceUserId);
     } else {
       try {
         // Use official Telegram SDK to retrieve launch parameters
@@ -136,10 +115,27 @@ export default function NeonClickerGame() {
   // Store previous score to prevent UI jumping during loading
   const [prevScore, setPrevScore] = useState(0);
 
+  const randomHex = () =>
+    Array.from(crypto.getRandomValues(new Uint8Array(16)), b => b.toString(16).padStart(2, '0')).join('');
+
+  // Stable per-install ID so the backend reuses one session per device
+  const getDeviceId = () => {
+    let id = localStorage.getItem('device_id');
+    if (!id) {
+      id = randomHex();
+      localStorage.setItem('device_id', id);
+    }
+    return id;
+  };
+
+  // One key per purchase or donation, so a retried request is never charged twice
+  const idempotencyHeaders = () => ({ 'Idempotency-Key': randomHex() });
+
   // Helper function to make authenticated API calls
   const makeAuthenticatedRequest = async (url: string, options: RequestInit = {}) => {
     const headers = {
       'Content-Type': 'application/json',
+      'X-Device-ID': getDeviceId(),
       ...options.headers,
     };
 
@@ -148,15 +144,14 @@ export default function NeonClickerGame() {
       headers['Authorization'] = `Bearer ${sessionId}`;
     } else if (initData) {
       headers['Authorization'] = `tma ${initData}`;
-    } else if (userId === '1234567') {
-      // Local development mode - use mock init data
-      // This should have been set in the initialization
-      throw new Error('No authentication available - check VITE_FORCE_USER_ID');
+    } else if ((import.meta as any).env?.VITE_FORCE_USER_ID && userId) {
+      // Local development mode - the backend must run with DEV_AUTH enabled
+      headers['Authorization'] = `dev ${userId}`;
     } else {
       throw new Error('No authentication available');
     }
 
-    const response = await fetch(url, {
+    let response = await fetch(url, {
       ...options,
       headers,
     });
@@ -170,13 +165,19 @@ export default function NeonClickerGame() {
           ...headers,
           'Authorization': `tma ${initData}`,
         };
-        return fetch(url, {
+        response = await fetch(url, {
           ...options,
           headers: retryHeaders,
         });
       }
     }
 
+    // The backend hands out a session token whenever we authenticate without one
+    const newSessionId = response.headers.get('X-Session-ID');
+    if (newSessionId) {
+      setSessionId(newSessionId);
+    }
+
     return response;
   };
 
@@ -188,14 +189,7 @@ export default function NeonClickerGame() {
     setError(null); // Clear any previous errors
     
     makeAuthenticatedRequest('/api/state')
-      .then(res => {
-        // Check if we got a session ID from the response headers
-        const newSessionId = res.headers.get('X-Session-ID');
-        if (newSessionId) {
-          setSessionId(newSessionId);
-        }
-        return res.json();
-      })
+      .then(res => res.json())
       .then(data => { 
         const newScore = data.score ?? 0;
         setPrevScore(newScore); // Set previous score to new score for smooth transition
@@ -374,24 +368,59 @@ export default function NeonClickerGame() {
     return () => clearInterval(syncInterval);
   }, [isInitialized, userId, isTelegramContext, fetchPowerInfo, fetchProducers]);
 
-  // Backend click handler (now no local optimistic, just fetch)
-  const backendClick = async () => {
-    if (!isInitialized || !userId) return;
-    // In Telegram context, only make calls for real users (not guest)
-    if (tgRef.current?.HapticFeedback) {
-      tgRef.current.HapticFeedback.impactOccurred('medium');
-    }
+  // Taps are buffered and sent to the backend in batches; the backend's score is authoritative
+  const clickBatchRef = useRef({ taps: 0, startedAt: 0, endedAt: 0, offsets: [] as number[], seq: Date.now(), inFlight: false });
+
+  const flushClicks = React.useCallback(async () => {
+    const batch = clickBatchRef.current;
+    if (batch.taps === 0 || batch.inFlight) return;
+    const taps = batch.taps;
+    const payload = { seq: ++batch.seq, taps, started_at: batch.startedAt, ended_at: batch.endedAt, offsets: batch.offsets };
+    batch.taps = 0;
+    batch.offsets = [];
+    batch.inFlight = true;
     try {
-      const res = await makeAuthenticatedRequest('/api/click', {
+      const res = await makeAuthenticatedRequest('/api/click/batch', {
         method: 'POST',
-        body: JSON.stringify({})
+        body: JSON.stringify(payload)
       });
       const result = await res.json();
-      setScore(result.score);
-      // Don't fetch power info on click - power doesn't change
+      if (!result.success && result.last_seq) {
+        batch.seq = Math.max(batch.seq, result.last_seq);
+      }
+      if (typeof result.score === 'number') {
+        // Keep taps made while the batch was in flight on top of the authoritative score
+        setScore(result.score + batch.taps * powerInfoRef.current.power);
+      }
     } catch (e) {
       setError('Failed to register click');
+    } finally {
+      batch.inFlight = false;
+    }
+  }, [userId, sessionId, initData]);
+
+  useEffect(() => {
+    const timer = setInterval(flushClicks, 1000);
+    return () => clearInterval(timer);
+  }, [flushClicks]);
+
+  const backendClick = () => {
+    if (!isInitialized || !userId) return;
+    // In Telegram context, only make calls for real users (not guest)
+    if (tgRef.current?.HapticFeedback) {
+      tgRef.current.HapticFeedback.impactOccurred('medium');
+    }
+    const batch = clickBatchRef.current;
+    const now = Date.now();
+    if (batch.taps === 0) {
+      // Windows may not overlap the previous batch
+      batch.startedAt = Math.max(now, batch.endedAt);
     }
+    batch.taps += 1;
+    batch.endedAt = Math.max(now, batch.startedAt);
+    // Tap timings let the backend spot machine-regular clicking
+    batch.offsets.push(batch.endedAt - batch.startedAt);
+    setScore(prev => prev + powerInfoRef.current.power);
   };
 
   // Override upgradePower to use backend
@@ -419,6 +448,7 @@ export default function NeonClickerGame() {
     try {
       const res = await makeAuthenticatedRequest('/api/upgrade_power', {
         method: 'POST',
+        headers: idempotencyHeaders(),
         body: JSON.stringify({})
       });
       const result = await res.json();
@@ -512,7 +542,7 @@ export default function NeonClickerGame() {
     makeAuthenticatedRequest('/api/leaderboard')
       .then(res => res.json())
       .then(data => {
-        const leaderboardData = Array.isArray(data) ? data : [];
+        const leaderboardData: LeaderboardEntryRichest[] = Array.isArray(data?.entries) ? data.entries : [];
         leaderboardData.sort((a, b) => (b.score || 0) - (a.score || 0));
         setLeaderboard(leaderboardData);
         setHasInitiallyLoadedRichest(true);
@@ -534,7 +564,7 @@ export default function NeonClickerGame() {
     makeAuthenticatedRequest('/api/per_second_leaderboard')
       .then(res => res.json())
       .then(data => {
-        const leaderboardData = Array.isArray(data) ? data : [];
+        const leaderboardData: LeaderboardEntryPerSecond[] = Array.isArray(data?.entries) ? data.entries : [];
         leaderboardData.sort((a, b) => (b.production_rate || 0) - (a.production_rate || 0));
         setPerSecondLeaderboard(leaderboardData);
         setHasInitiallyLoadedPerSecond(true);
@@ -580,6 +610,7 @@ export default function NeonClickerGame() {
       setDonationSubmitting({ goalId, percent });
       const res = await makeAuthenticatedRequest('/api/donations/donate', {
         method: 'POST',
+        headers: idempotencyHeaders(),
         body: JSON.stringify({ goal_id: goalId, percent })
       });
       const result = await res.json();
@@ -617,7 +648,7 @@ export default function NeonClickerGame() {
     makeAuthenticatedRequest('/api/clicks_leaderboard')
       .then(res => res.json())
       .then(data => {
-        const leaderboardData = Array.isArray(data) ? data : [];
+        const leaderboardData: LeaderboardEntryClicks[] = Array.isArray(data?.entries) ? data.entries : [];
         setClicksLeaderboard(leaderboardData);
         setHasInitiallyLoadedClicks(true);
       })
@@ -760,6 +791,7 @@ export default function NeonClickerGame() {
     try {
       const res = await makeAuthenticatedRequest('/api/buy_producer', {
         method: 'POST',
+        headers: idempotencyHeaders(),
         body: JSON.stringify({ 
           producer_id: producer.id 
         })
@@ -161,7 +161,7 @@ const DonationItem: React.FC<DonationItemProps> = ({
                         i === 0 ? 'bg-yellow-400/20 text-yellow-300 border border-yellow-400/30' : 'bg-white/5 text-gray-400 border border-white/10'
                       }`}>{i + 1}</div>
                       <div className={`font-light ${isSelf ? 'text-yellow-400' : 'text-gray-300'}`}>
-                        {isSelf ? 'You' : d.user_id}
+                        {isSelf ? 'You' : d.display_name || d.user_id}
                       </div>
                     </div>
                     <div className="text-cyan-400">{Number(d.amount).toLocaleString()}</div>
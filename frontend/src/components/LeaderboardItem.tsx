@@ -53,7 +53,7 @@ const LeaderboardItem: React.FC<LeaderboardItemProps> = ({ index, entry, mode })
           {index + 1}
         </div>
         <div className={`font-light ${isSelf ? 'text-yellow-400' : 'text-gray-300'}`}>
-          {isSelf ? 'You' : entry.user_id}
+          {isSelf ? 'You' : entry.display_name || entry.user_id}
         </div>
       </div>
       {right}
@@ -24,7 +24,9 @@ export interface PowerInfo {
 }
 
 export interface LeaderboardEntryBase {
+  rank?: number;
   user_id: string;
+  display_name?: string;
   is_self?: boolean;
 }
 
@@ -50,6 +52,7 @@ export interface DonationGoal {
 
 export interface DonationTopDonor {
   user_id: string;
+  display_name?: string;
   amount: number;
   is_self?: boolean;
 }
@@ -37,7 +37,7 @@ docker run -d \
   --name backend \
   -e REDIS_ADDR=redis:6379 \
   -e TELEGRAM_BOT_TOKEN="$TELEGRAM_BOT_TOKEN" \
-  -p 8080:8080 \
+  -e TRUST_PROXY=true \
   emoji-backend
 
 echo "🚀 Starting frontend..."